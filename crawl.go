@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	_ "net/http/pprof"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/1F47E/go-btc-xray/internal/client"
+	"github.com/1F47E/go-btc-xray/internal/config"
+	"github.com/1F47E/go-btc-xray/internal/dns"
+	"github.com/1F47E/go-btc-xray/internal/gui"
+	"github.com/1F47E/go-btc-xray/internal/logger"
+	"github.com/1F47E/go-btc-xray/internal/printer"
+	"github.com/1F47E/go-btc-xray/internal/seeder"
+	"github.com/1F47E/go-btc-xray/internal/seeds"
+	"github.com/1F47E/go-btc-xray/internal/storage"
+)
+
+type crawlOptions struct {
+	// serve good nodes as a dns seed
+	seed bool
+	// stop after, 0 runs until interrupted
+	duration time.Duration
+}
+
+func crawlCommand() *command {
+	c := newCommand("crawl", "", "crawl the network with the terminal UI (default)",
+		"Resolves the DNS seeds, connects to the nodes and asks them for more addresses.\n"+
+			"Good nodes and the reports are saved to the data dir.", 0)
+	duration := c.fs.Duration("for", 0, "stop after the duration, runs until interrupted if 0")
+	c.run = func(cfg *config.Config, args []string) error {
+		return runCrawl(cfg, crawlOptions{duration: *duration})
+	}
+	return c
+}
+
+func monitorCommand() *command {
+	c := newCommand("monitor", "", "crawl and keep the connections to record announcements",
+		"Crawls in the observation mode: connections are kept open, tx and block announcements\n"+
+			"are recorded with receive timestamps. Propagation and block race reports are saved to the data dir.", 0)
+	duration := c.fs.Duration("for", 0, "stop after the duration, runs until interrupted if 0")
+	c.run = func(cfg *config.Config, args []string) error {
+		cfg.Observe = true
+		return runCrawl(cfg, crawlOptions{duration: *duration})
+	}
+	return c
+}
+
+func seedCommand() *command {
+	c := newCommand("seed", "", "crawl and serve good nodes as an authoritative DNS seed",
+		"Runs the crawler and a DNS server for the seed_zone. Nodes verified within seed_max_age\n"+
+			"are served, good nodes are re-verified every seed_recheck.", 0)
+	c.run = func(cfg *config.Config, args []string) error {
+		return runCrawl(cfg, crawlOptions{seed: true})
+	}
+	return c
+}
+
+func runCrawl(cfg *config.Config, opts crawlOptions) error {
+	printer.Banner()
+
+	guiCh := make(chan gui.IncomingData, 42)
+	log := logger.New(cfg, guiCh)
+
+	// create temp folders
+	err := storage.New(cfg).Bootstrap()
+	if err != nil {
+		log.Fatalf("failed to bootstrap the storage: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// scripted runs stop after the duration, results are saved every second
+	if opts.duration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.duration)
+	}
+
+	// TUI
+	var ui *gui.GUI
+	if cfg.Gui {
+		ui = gui.New(ctx, cfg, guiCh)
+		go ui.Start()
+	}
+
+	// RPC CLIENT
+	c := client.NewClient(ctx, cfg, log, guiCh)
+
+	// DNS SEEDER
+	// `xray seed` serves recently verified good nodes as an authoritative dns seed
+	if opts.seed {
+		s, err := seeder.New(cfg, log)
+		if err != nil {
+			log.Fatalf("failed to create the seeder: %v", err)
+		}
+		c.EnableRecheck(cfg.SeedRecheck)
+		go s.Watch(ctx, c.GoodNodes)
+		go func() {
+			if err := s.Start(ctx); err != nil {
+				log.Errorf("[SEEDER]: stopped: %v\n", err)
+				cancel()
+			}
+		}()
+	}
+
+	if !cfg.DryRun {
+		// BOOTSTRAP
+		// load seed files, scan seed nodes, add them to the client
+		go func() {
+			total := 0
+			for _, f := range cfg.SeedFiles {
+				seedAddrs, err := seeds.Load(f, cfg.Btcnet, cfg.NodesPort)
+				if err != nil {
+					log.Errorf("[SEEDS]:[%s] failed to load: %v\n", f, err)
+					continue
+				}
+				log.Infof("[SEEDS]:[%s] loaded %d nodes\n", f, len(seedAddrs))
+				c.AddSeedNodes(client.SeedFilePrefix+filepath.Base(f), seeds.Endpoints(seedAddrs))
+				total += len(seedAddrs)
+			}
+			d := dns.New(cfg, log)
+			scanCtx, scanCancel := context.WithTimeout(ctx, cfg.DnsScanTimeout)
+			res := d.Scan(scanCtx)
+			scanCancel()
+			// answers are tagged with the seed for the quality report
+			for seed, ips := range res.BySeed {
+				c.AddSeedNodes(seed, ips)
+			}
+			total += len(res.Addrs)
+			bootstrap := "dns"
+			// fallback to the compiled-in seeds like bitcoin core does
+			if len(res.Addrs) == 0 {
+				fixed, err := seeds.Fixed(string(cfg.Name), cfg.NodesPort)
+				if len(cfg.FixedSeeds) > 0 {
+					fixed, err = seeds.ParseList([]byte(strings.Join(cfg.FixedSeeds, "\n")), cfg.NodesPort)
+				}
+				if err != nil {
+					log.Errorf("[SEEDS]: failed to load fixed seeds: %v\n", err)
+				} else if len(fixed) == 0 {
+					log.Errorf("[SEEDS]: fixed seeds list for %s is empty, fill internal/seeds/contrib and run go generate ./internal/seeds\n", cfg.Name)
+				} else {
+					log.Warnf("[SEEDS]: DNS seeds gave no nodes (timeout: %v), using %d fixed seeds\n", res.TimedOut, len(fixed))
+					c.AddSeedNodes(client.SeedFixed, seeds.Endpoints(fixed))
+					total += len(fixed)
+					bootstrap = "fixed"
+				}
+			}
+			if total == 0 {
+				log.Fatalf("no seed nodes found")
+			}
+			// show the bootstrap source in the gui, do not block without gui
+			select {
+			case guiCh <- gui.IncomingData{Bootstrap: bootstrap}:
+			default:
+			}
+			// start the client after seed nodes are added
+			go c.Start()
+		}()
+	}
+
+	// PROFILING
+	if cfg.Pprof != "" {
+		go func() {
+			_ = http.ListenAndServe(cfg.Pprof, nil)
+		}()
+	}
+
+	// GRACEFUL SHUTDOWN
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+		log.Debug("received exit signal, canceling ctx")
+		cancel()
+	}()
+
+	log.Debug("waiting for the context to be canceled")
+	// blocking, waiting for all the goroutines to exit
+	<-ctx.Done()
+	log.Debug("context canceled, exiting")
+	log.ResetToStdout()
+	// exit from GUI
+	if ui != nil {
+		go ui.Stop()
+	}
+	// RPC disconnect from all the nodes
+	c.Disconnect()
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/1F47E/go-btc-xray/internal/client/node"
+	"github.com/1F47E/go-btc-xray/internal/config"
+	"github.com/1F47E/go-btc-xray/internal/storage"
+)
+
+// change of one field of a node between two crawls
+type change struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+type nodesDiff struct {
+	Added     []string            `json:"added"`
+	Removed   []string            `json:"removed"`
+	Changed   map[string][]change `json:"changed"`
+	Unchanged int                 `json:"unchanged"`
+}
+
+func diffCommand() *command {
+	c := newCommand("diff", "<old> <new>", "compare two saved nodes files",
+		"Lists the nodes added and removed between two crawls and the nodes with a changed\n"+
+			"user agent, protocol version, services, transport, chain status or pruning.", 2)
+	asJSON := c.fs.Bool("json", false, "print json")
+	c.run = func(cfg *config.Config, args []string) error {
+		old, err := storage.Load(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %v", args[0], err)
+		}
+		cur, err := storage.Load(args[1])
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %v", args[1], err)
+		}
+		d := diffNodes(old, cur)
+		if *asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(d)
+		}
+		d.print(os.Stdout)
+		return nil
+	}
+	return c
+}
+
+func diffNodes(old, cur []node.Record) *nodesDiff {
+	d := &nodesDiff{
+		Added:   make([]string, 0),
+		Removed: make([]string, 0),
+		Changed: make(map[string][]change),
+	}
+	before := make(map[string]node.Record, len(old))
+	for _, r := range old {
+		before[hostPort(r.Endpoint)] = r
+	}
+	after := make(map[string]bool, len(cur))
+	for _, r := range cur {
+		endpoint := hostPort(r.Endpoint)
+		after[endpoint] = true
+		prev, ok := before[endpoint]
+		if !ok {
+			d.Added = append(d.Added, endpoint)
+			continue
+		}
+		if changes := compare(prev, r); len(changes) > 0 {
+			d.Changed[endpoint] = changes
+		} else {
+			d.Unchanged++
+		}
+	}
+	for endpoint := range before {
+		if !after[endpoint] {
+			d.Removed = append(d.Removed, endpoint)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	return d
+}
+
+// compare the fields that tell about a node upgrade or a behavior change,
+// heights change on every crawl
+func compare(a, b node.Record) []change {
+	fields := []struct {
+		name     string
+		old, new string
+	}{
+		{"user_agent", a.UserAgent, b.UserAgent},
+		{"version", fmt.Sprint(a.Version), fmt.Sprint(b.Version)},
+		{"services", a.Services.String(), b.Services.String()},
+		{"transport", a.Transport, b.Transport},
+		{"chain_status", string(a.ChainStatus), string(b.ChainStatus)},
+		{"prune", string(a.Prune), string(b.Prune)},
+	}
+	var ret []change
+	for _, f := range fields {
+		if f.old != f.new {
+			ret = append(ret, change{Field: f.name, Old: f.old, New: f.new})
+		}
+	}
+	return ret
+}
+
+func (d *nodesDiff) print(w io.Writer) {
+	for _, e := range d.Added {
+		fmt.Fprintf(w, "+ %s\n", e)
+	}
+	for _, e := range d.Removed {
+		fmt.Fprintf(w, "- %s\n", e)
+	}
+	changed := make([]string, 0, len(d.Changed))
+	for e := range d.Changed {
+		changed = append(changed, e)
+	}
+	sort.Strings(changed)
+	for _, e := range changed {
+		for _, c := range d.Changed[e] {
+			fmt.Fprintf(w, "~ %s %s: %q -> %q\n", e, c.Field, c.Old, c.New)
+		}
+	}
+	fmt.Fprintf(w, "added %d, removed %d, changed %d, unchanged %d\n", len(d.Added), len(d.Removed), len(d.Changed), d.Unchanged)
+}
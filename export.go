@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/1F47E/go-btc-xray/internal/client/node"
+	"github.com/1F47E/go-btc-xray/internal/config"
+	"github.com/1F47E/go-btc-xray/internal/storage"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+func exportCommand() *command {
+	c := newCommand("export", "", "export saved nodes as a seed list, csv or json",
+		"Writes the good nodes of the network (data_dir/nodes_filename) or of the --in file.\n"+
+			"txt is a host:port list accepted by --seeds and the fixed seeds.", 0)
+	in := c.fs.String("in", "", "nodes file, the network nodes file by default")
+	out := c.fs.String("out", "", "output file, stdout by default")
+	format := c.fs.String("format", "txt", "txt, csv or json")
+	services := c.fs.String("services", "", "only nodes with the service bits, 0x9")
+	c.run = func(cfg *config.Config, args []string) error {
+		path := *in
+		if path == "" {
+			path = filepath.Join(cfg.DataDir, cfg.NodesFilename)
+		}
+		records, err := storage.Load(path)
+		if err != nil {
+			return fmt.Errorf("failed to load nodes: %v", err)
+		}
+		if *services != "" {
+			sf, err := strconv.ParseUint(*services, 0, 64)
+			if err != nil {
+				return fmt.Errorf("bad service bits %q", *services)
+			}
+			records = filterServices(records, wire.ServiceFlag(sf))
+		}
+		w := io.Writer(os.Stdout)
+		if *out != "" {
+			f, err := os.Create(*out)
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %v", *out, err)
+			}
+			defer f.Close()
+			w = f
+		}
+		switch *format {
+		case "txt":
+			return exportTxt(w, records)
+		case "csv":
+			return exportCsv(w, records)
+		case "json":
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(records)
+		default:
+			return fmt.Errorf("unknown format %q, expected txt, csv or json", *format)
+		}
+	}
+	return c
+}
+
+func filterServices(records []node.Record, services wire.ServiceFlag) []node.Record {
+	ret := make([]node.Record, 0, len(records))
+	for _, r := range records {
+		if r.Services&services == services {
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
+
+// hostPort of the saved endpoint, brackets only for ipv6
+func hostPort(endpoint string) string {
+	host, port, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return endpoint
+	}
+	return net.JoinHostPort(host, port)
+}
+
+func exportTxt(w io.Writer, records []node.Record) error {
+	for _, r := range records {
+		_, err := fmt.Fprintln(w, hostPort(r.Endpoint))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exportCsv(w io.Writer, records []node.Record) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{
+		"endpoint", "version", "user_agent", "services", "height",
+		"best_height", "chain_status", "prune", "transport",
+		"country", "city", "asn", "org",
+	})
+	for _, r := range records {
+		asn := ""
+		if r.ASN != 0 {
+			asn = fmt.Sprint(r.ASN)
+		}
+		_ = cw.Write([]string{
+			hostPort(r.Endpoint),
+			fmt.Sprint(r.Version),
+			r.UserAgent,
+			fmt.Sprintf("0x%x", uint64(r.Services)),
+			fmt.Sprint(r.Height),
+			fmt.Sprint(r.BestHeight),
+			string(r.ChainStatus),
+			string(r.Prune),
+			r.Transport,
+			r.Country,
+			r.City,
+			asn,
+			r.Org,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,311 @@
+package bip324
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("bad hex %q: %v", s, err)
+	}
+	return b
+}
+
+// ellswift_decode_test_vectors.csv of BIP 324
+func TestXSwiftEC(t *testing.T) {
+	tests := []struct {
+		ellswift string
+		x        string
+	}{
+		{
+			"00000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+			"edd1fd3e327ce90cc7a3542614289aee9682003e9cf7dcc9cf2ca9743be5aa0c",
+		},
+		{
+			"000000000000000000000000000000000000000000000000000000000000000001d3475bf7655b0fb2d852921035b2ef607f49069b97454e6795251062741771",
+			"b5da00b73cd6560520e7c364086e7cd23a34bf60d0e707be9fc34d4cd5fdfa2c",
+		},
+		{
+			"0000000000000000000000000000000000000000000000000000000000000000bde70df51939b94c9c24979fa7dd04ebd9b3572da7802290438af2a681895441",
+			"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa9fffffd6b",
+		},
+		{
+			"0000000000000000000000000000000000000000000000000000000000000000fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f",
+			"edd1fd3e327ce90cc7a3542614289aee9682003e9cf7dcc9cf2ca9743be5aa0c",
+		},
+		{
+			"0000000000000000000000000000000000000000000000000000000000000000ffffffffffffffffffffffffffffffffffffffffffffffffffffffff7028de7d",
+			"1eea9cc59cfcf2fa151ac6c274eea4110feb4f7b68c5965732e9992e976ef68e",
+		},
+		{
+			"0a2d2ba93507f1df233770c2a797962cc61f6d15da14ecd47d8d27ae1cd5f8530000000000000000000000000000000000000000000000000000000000000000",
+			"532167c11200b08c0e84a354e74dcc40f8b25f4fe686e30869526366278a0688",
+		},
+		{
+			"0ffde9ca81d751e9cdaffc1a50779245320b28996dbaf32f822f20117c22fbd6c74d99efceaa550f1ad1c0f43f46e7ff1ee3bd0162b7bf55f2965da9c3450646",
+			"74e880b3ffd18fe3cddf7902522551ddf97fa4a35a3cfda8197f947081a57b8f",
+		},
+		{
+			"1f67edf779a8a649d6def60035f2fa22d022dd359079a1a144073d84f19b92d5fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f",
+			"025661f9aba9d15c3118456bbe980e3e1b8ba2e047c737a4eb48a040bb566f6c",
+		},
+	}
+	for _, tt := range tests {
+		enc := mustHex(t, tt.ellswift)
+		u := fe(new(big.Int).SetBytes(enc[:32]))
+		v := fe(new(big.Int).SetBytes(enc[32:]))
+		var got [32]byte
+		xswiftec(u, v).FillBytes(got[:])
+		if !bytes.Equal(got[:], mustHex(t, tt.x)) {
+			t.Errorf("xswiftec(%s) = %x, want %s", tt.ellswift, got, tt.x)
+		}
+	}
+}
+
+// xswiftec_inv_test_vectors.csv of BIP 324, empty case has no solution
+func TestXSwiftECInv(t *testing.T) {
+	tests := []struct {
+		u     string
+		x     string
+		cases [8]string
+	}{
+		{
+			u: "05ff6bdad900fc3261bc7fe34e2fb0f569f06e091ae437d3a52e9da0cbfb9590",
+			x: "80cdf63774ec7022c89a5a8558e373a279170285e0ab27412dbce510bdfe23fc",
+			cases: [8]string{
+				"",
+				"",
+				"45654798ece071ba79286d04f7f3eb1c3f1d17dd883610f2ad2efd82a287466b",
+				"0aeaa886f6b76c7158452418cbf5033adc5747e9e9b5d3b2303db96936528557",
+				"",
+				"",
+				"ba9ab867131f8e4586d792fb080c14e3c0e2e82277c9ef0d52d1027c5d78b5c4",
+				"f51557790948938ea7badbe7340afcc523a8b816164a2c4dcfc24695c9ad76d8",
+			},
+		},
+		{
+			u: "1737a85f4c8d146cec96e3ffdca76d9903dcf3bd53061868d478c78c63c2aa9e",
+			x: "39e48dd150d2f429be088dfd5b61882e7e8407483702ae9a5ab35927b15f85ea",
+			cases: [8]string{
+				"1be8cc0b04be0c681d0c6a68f733f82c6c896e0c8a262fcd392918e303a7abf4",
+				"605b5814bf9b8cb066667c9e5480d22dc5b6c92f14b4af3ee0a9eb83b03685e3",
+				"",
+				"",
+				"e41733f4fb41f397e2f3959708cc07d3937691f375d9d032c6d6e71bfc58503b",
+				"9fa4a7eb4064734f99998361ab7f2dd23a4936d0eb4b50c11f56147b4fc9764c",
+				"",
+				"",
+			},
+		},
+		{
+			u: "1aaa1ccebf9c724191033df366b36f691c4d902c228033ff4516d122b2564f68",
+			x: "c75541259d3ba98f207eaa30c69634d187d0b6da594e719e420f4898638fc5b0",
+		},
+	}
+	for _, tt := range tests {
+		u := new(big.Int).SetBytes(mustHex(t, tt.u))
+		x := new(big.Int).SetBytes(mustHex(t, tt.x))
+		for c, want := range tt.cases {
+			got := xswiftecInv(x, u, c)
+			if want == "" {
+				if got != nil {
+					t.Errorf("u %s case %d: got %x, want no solution", tt.u, c, got)
+				}
+				continue
+			}
+			if got == nil {
+				t.Errorf("u %s case %d: no solution, want %s", tt.u, c, want)
+				continue
+			}
+			var b [32]byte
+			got.FillBytes(b[:])
+			if !bytes.Equal(b[:], mustHex(t, want)) {
+				t.Errorf("u %s case %d: got %x, want %s", tt.u, c, b, want)
+			}
+		}
+	}
+}
+
+func TestNewKeyEncodesPublic(t *testing.T) {
+	g := &point{x: curveGx, y: curveGy, z: big.NewInt(1)}
+	for i := 0; i < 8; i++ {
+		k, err := NewKey(nil)
+		if err != nil {
+			t.Fatalf("failed to create key: %v", err)
+		}
+		u := new(big.Int).SetBytes(k.Public[:32])
+		v := new(big.Int).SetBytes(k.Public[32:])
+		if xswiftec(u, v).Cmp(g.mul(k.priv).affineX()) != 0 {
+			t.Fatalf("public key %x does not decode to the private key", k.Public)
+		}
+	}
+}
+
+// fixed keys, the expected secret is computed with btcec/v2/ellswift,
+// session keys and packets with an independent implementation of the BIP 324 ciphers
+const (
+	vectorPriv    = "61062ea5071d800bbfd59e2e8b53d47d194b095ae5a4df04936b49772ef0d4d7"
+	vectorOurs    = "ec0adff257bbfe500c188c80b4fdd640f6b45a482bbc15fc7cef5931deff0aa186f6eb9bba7b85dc4dcc28b28722de1e3d9108b985e2967045668f66098e475b"
+	vectorTheirs  = "a4a94dfce69b4a2a0a099313d10f9f7e7d649d60501c9e1d274c300e0d89aafaffffffffffffffffffffffffffffffffffffffffffffffffffffff8faf88d5"
+	vectorXOurs   = "19e965bc20fc40614e33f2f82d4eeff81b5e7516b12a5c6c0d6053527eba0923"
+	vectorSecret  = "5c63577c03c108430926d5f9c73a66af4e51e6e1886370e05f5eb9b3fa7001e2"
+	vectorSession = "2518c13524166b26a3b408b643d1f488a51aa99cfce84c68c8c96ab662822da3"
+)
+
+func vectorKey(t *testing.T) (*Key, [PubKeyLen]byte) {
+	t.Helper()
+	k := &Key{priv: new(big.Int).SetBytes(mustHex(t, vectorPriv))}
+	copy(k.Public[:], mustHex(t, vectorOurs))
+	var theirs [PubKeyLen]byte
+	copy(theirs[:], mustHex(t, vectorTheirs))
+	return k, theirs
+}
+
+func TestECDH(t *testing.T) {
+	k, theirs := vectorKey(t)
+	u := new(big.Int).SetBytes(k.Public[:32])
+	v := new(big.Int).SetBytes(k.Public[32:])
+	var x [32]byte
+	xswiftec(u, v).FillBytes(x[:])
+	if !bytes.Equal(x[:], mustHex(t, vectorXOurs)) {
+		t.Fatalf("our x = %x, want %s", x, vectorXOurs)
+	}
+
+	secret, err := k.ECDH(theirs, true)
+	if err != nil {
+		t.Fatalf("ecdh failed: %v", err)
+	}
+	if !bytes.Equal(secret[:], mustHex(t, vectorSecret)) {
+		t.Errorf("initiator secret = %x, want %s", secret, vectorSecret)
+	}
+	// responder hashes the keys in the other order
+	secret, err = k.ECDH(theirs, false)
+	if err != nil {
+		t.Fatalf("ecdh failed: %v", err)
+	}
+	if want := "c423174c04b5aa68ca16317cf16826d5df7a34526066d8a13cb9266d6c24930f"; !bytes.Equal(secret[:], mustHex(t, want)) {
+		t.Errorf("responder secret = %x, want %s", secret, want)
+	}
+
+	// both sides of a random exchange agree
+	a, err := NewKey(nil)
+	if err != nil {
+		t.Fatalf("failed to create key: %v", err)
+	}
+	b, err := NewKey(nil)
+	if err != nil {
+		t.Fatalf("failed to create key: %v", err)
+	}
+	sa, err := a.ECDH(b.Public, true)
+	if err != nil {
+		t.Fatalf("ecdh failed: %v", err)
+	}
+	sb, err := b.ECDH(a.Public, false)
+	if err != nil {
+		t.Fatalf("ecdh failed: %v", err)
+	}
+	if sa != sb {
+		t.Errorf("initiator secret %x, responder %x", sa, sb)
+	}
+}
+
+func vectorSessions(t *testing.T) (initiator, responder *Session) {
+	t.Helper()
+	var secret [32]byte
+	copy(secret[:], mustHex(t, vectorSecret))
+	initiator, err := NewSession(secret, wire.MainNet, true)
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	responder, err = NewSession(secret, wire.MainNet, false)
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	return initiator, responder
+}
+
+func TestSessionKeys(t *testing.T) {
+	s, r := vectorSessions(t)
+	if !bytes.Equal(s.SessionID[:], mustHex(t, vectorSession)) {
+		t.Errorf("session id = %x, want %s", s.SessionID, vectorSession)
+	}
+	if want := "0ce9726dcfbefad535aa3a7265bd5af3"; !bytes.Equal(s.SendTerminator[:], mustHex(t, want)) {
+		t.Errorf("send terminator = %x, want %s", s.SendTerminator, want)
+	}
+	if want := "d6db3bc217a374e1e9cff8d986b56bba"; !bytes.Equal(s.RecvTerminator[:], mustHex(t, want)) {
+		t.Errorf("recv terminator = %x, want %s", s.RecvTerminator, want)
+	}
+	if r.SessionID != s.SessionID || r.SendTerminator != s.RecvTerminator || r.RecvTerminator != s.SendTerminator {
+		t.Errorf("responder keys do not mirror the initiator ones")
+	}
+
+	// the magic is a part of the salt
+	var secret [32]byte
+	copy(secret[:], mustHex(t, vectorSecret))
+	testnet, err := NewSession(secret, wire.TestNet3, true)
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	if testnet.SessionID == s.SessionID {
+		t.Errorf("same session id on mainnet and testnet")
+	}
+}
+
+func TestPacketEncryption(t *testing.T) {
+	s, r := vectorSessions(t)
+	tests := []struct {
+		// packets sent before this one, crossing the rekey interval
+		skip     int
+		contents string
+		aad      string
+		ignore   bool
+		want     string
+	}{
+		{0, "8e", "", false, "5b7c687eb42197657d10ceeea0c2fad860da0a138b"},
+		{298, "68656c6c6f", "0102", true, "137e0dc119c6dc935eec0227499d5b8e6c38971a0c1082d13b"},
+	}
+	for _, tt := range tests {
+		for i := 0; i < tt.skip; i++ {
+			packet := s.Encrypt(nil, nil, false)
+			if n := r.DecryptLength(packet); n != 0 {
+				t.Fatalf("skipped packet length %d", n)
+			}
+			_, _, err := r.Decrypt(packet[LengthLen:], nil)
+			if err != nil {
+				t.Fatalf("failed to decrypt skipped packet: %v", err)
+			}
+		}
+		contents, aad := mustHex(t, tt.contents), mustHex(t, tt.aad)
+		packet := s.Encrypt(contents, aad, tt.ignore)
+		if !bytes.Equal(packet, mustHex(t, tt.want)) {
+			t.Errorf("packet after %d = %x, want %s", tt.skip, packet, tt.want)
+		}
+
+		n := r.DecryptLength(packet)
+		if int(n) != len(contents) || len(packet) != LengthLen+int(n)+Overhead {
+			t.Fatalf("decrypted length %d, packet %d bytes", n, len(packet))
+		}
+		got, ignore, err := r.Decrypt(packet[LengthLen:], aad)
+		if err != nil {
+			t.Fatalf("failed to decrypt: %v", err)
+		}
+		if !bytes.Equal(got, contents) || ignore != tt.ignore {
+			t.Errorf("decrypted %x ignore %v, want %x ignore %v", got, ignore, contents, tt.ignore)
+		}
+	}
+
+	// tampered packet fails the authentication
+	packet := s.Encrypt([]byte("ping"), nil, false)
+	packet[len(packet)-1] ^= 1
+	r.DecryptLength(packet)
+	if _, _, err := r.Decrypt(packet[LengthLen:], nil); err != ErrDecrypt {
+		t.Errorf("tampered packet: got %v, want %v", err, ErrDecrypt)
+	}
+}
@@ -0,0 +1,106 @@
+package bip324
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// both ciphers take a new key after this many messages
+const rekeyInterval = 224
+
+// fsChaCha20 encrypts the packet lengths, one keystream over all the
+// messages, every rekeyInterval the next 32 bytes of it are the new key
+type fsChaCha20 struct {
+	stream *chacha20.Cipher
+	chunks uint32
+	rekeys uint64
+}
+
+func newFSChaCha20(key []byte) *fsChaCha20 {
+	c := &fsChaCha20{}
+	c.setKey(key)
+	return c
+}
+
+func (c *fsChaCha20) setKey(key []byte) {
+	var nonce [chacha20.NonceSize]byte
+	binary.LittleEndian.PutUint64(nonce[4:], c.rekeys)
+	stream, err := chacha20.NewUnauthenticatedCipher(key, nonce[:])
+	if err != nil {
+		// key and nonce sizes are constant
+		panic(err)
+	}
+	c.stream = stream
+}
+
+func (c *fsChaCha20) crypt(dst, src []byte) {
+	c.stream.XORKeyStream(dst, src)
+	c.chunks++
+	if c.chunks < rekeyInterval {
+		return
+	}
+	var key [chacha20.KeySize]byte
+	c.stream.XORKeyStream(key[:], key[:])
+	c.chunks = 0
+	c.rekeys++
+	c.setKey(key[:])
+}
+
+// fsAEAD encrypts the packets, the nonce is the packet counter,
+// on rekey the new key is the encryption of zeros with a special nonce
+type fsAEAD struct {
+	aead    cipher.AEAD
+	packets uint32
+	rekeys  uint64
+}
+
+func newFSAEAD(key []byte) *fsAEAD {
+	c := &fsAEAD{}
+	c.setKey(key)
+	return c
+}
+
+func (c *fsAEAD) setKey(key []byte) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		panic(err)
+	}
+	c.aead = aead
+}
+
+func (c *fsAEAD) nonce(packet uint32) []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.LittleEndian.PutUint32(nonce[:4], packet)
+	binary.LittleEndian.PutUint64(nonce[4:], c.rekeys)
+	return nonce
+}
+
+func (c *fsAEAD) next() {
+	c.packets++
+	if c.packets < rekeyInterval {
+		return
+	}
+	zero := make([]byte, chacha20poly1305.KeySize)
+	key := c.aead.Seal(nil, c.nonce(0xffffffff), zero, nil)[:chacha20poly1305.KeySize]
+	c.packets = 0
+	c.rekeys++
+	c.setKey(key)
+}
+
+func (c *fsAEAD) seal(plaintext, aad []byte) []byte {
+	ret := c.aead.Seal(nil, c.nonce(c.packets), plaintext, aad)
+	c.next()
+	return ret
+}
+
+func (c *fsAEAD) open(ciphertext, aad []byte) ([]byte, error) {
+	ret, err := c.aead.Open(nil, c.nonce(c.packets), ciphertext, aad)
+	if err != nil {
+		return nil, err
+	}
+	c.next()
+	return ret, nil
+}
@@ -0,0 +1,302 @@
+// Package bip324 implements the cryptography of the v2 encrypted transport:
+// ElligatorSwift key exchange and the rekeying ChaCha20 packet ciphers.
+package bip324
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// PubKeyLen is the size of the ElligatorSwift encoded public key, u and t
+const PubKeyLen = 64
+
+var ErrInvalidKey = errors.New("invalid ellswift public key")
+
+// secp256k1 in affine and jacobian coordinates over math/big.
+// Keys are ephemeral, one per connection, operations are not constant time.
+var (
+	fieldP, _  = new(big.Int).SetString("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f", 16)
+	curveN, _  = new(big.Int).SetString("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141", 16)
+	curveGx, _ = new(big.Int).SetString("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798", 16)
+	curveGy, _ = new(big.Int).SetString("483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8", 16)
+	// sqrt(-3) mod p
+	sqrtMinus3, _ = new(big.Int).SetString("0a2d2ba93507f1df233770c2a797962cc61f6d15da14ecd47d8d27ae1cd5f852", 16)
+
+	ecdhTag = []byte("bip324_ellswift_xonly_ecdh")
+)
+
+// field arithmetic mod p, results are always reduced
+
+func fe(x *big.Int) *big.Int {
+	return new(big.Int).Mod(x, fieldP)
+}
+
+func feAdd(a, b *big.Int) *big.Int {
+	return fe(new(big.Int).Add(a, b))
+}
+
+func feSub(a, b *big.Int) *big.Int {
+	return fe(new(big.Int).Sub(a, b))
+}
+
+func feMul(a, b *big.Int) *big.Int {
+	return fe(new(big.Int).Mul(a, b))
+}
+
+func feNeg(a *big.Int) *big.Int {
+	return fe(new(big.Int).Neg(a))
+}
+
+func feInv(a *big.Int) *big.Int {
+	return new(big.Int).ModInverse(a, fieldP)
+}
+
+func feDiv(a, b *big.Int) *big.Int {
+	return feMul(a, feInv(b))
+}
+
+// feSqrt returns nil if a is not a square
+func feSqrt(a *big.Int) *big.Int {
+	return new(big.Int).ModSqrt(a, fieldP)
+}
+
+// curveY2 is x^3 + 7
+func curveY2(x *big.Int) *big.Int {
+	return feAdd(feMul(feMul(x, x), x), big.NewInt(7))
+}
+
+func isValidX(x *big.Int) bool {
+	return feSqrt(curveY2(x)) != nil
+}
+
+// jacobian point, z = 0 is the point at infinity
+type point struct {
+	x, y, z *big.Int
+}
+
+func (p *point) infinity() bool {
+	return p.z.Sign() == 0
+}
+
+func (p *point) double() *point {
+	if p.infinity() || p.y.Sign() == 0 {
+		return &point{x: big.NewInt(0), y: big.NewInt(1), z: big.NewInt(0)}
+	}
+	a := feMul(p.x, p.x)
+	b := feMul(p.y, p.y)
+	c := feMul(b, b)
+	xb := feAdd(p.x, b)
+	d := feMul(big.NewInt(2), feSub(feSub(feMul(xb, xb), a), c))
+	e := feMul(big.NewInt(3), a)
+	f := feMul(e, e)
+	x3 := feSub(f, feMul(big.NewInt(2), d))
+	y3 := feSub(feMul(e, feSub(d, x3)), feMul(big.NewInt(8), c))
+	z3 := feMul(big.NewInt(2), feMul(p.y, p.z))
+	return &point{x: x3, y: y3, z: z3}
+}
+
+func (p *point) add(q *point) *point {
+	if p.infinity() {
+		return q
+	}
+	if q.infinity() {
+		return p
+	}
+	z1z1 := feMul(p.z, p.z)
+	z2z2 := feMul(q.z, q.z)
+	u1 := feMul(p.x, z2z2)
+	u2 := feMul(q.x, z1z1)
+	s1 := feMul(feMul(p.y, q.z), z2z2)
+	s2 := feMul(feMul(q.y, p.z), z1z1)
+	h := feSub(u2, u1)
+	r := feSub(s2, s1)
+	if h.Sign() == 0 {
+		if r.Sign() == 0 {
+			return p.double()
+		}
+		return &point{x: big.NewInt(0), y: big.NewInt(1), z: big.NewInt(0)}
+	}
+	h2 := feMul(h, h)
+	h3 := feMul(h, h2)
+	u1h2 := feMul(u1, h2)
+	x3 := feSub(feSub(feMul(r, r), h3), feMul(big.NewInt(2), u1h2))
+	y3 := feSub(feMul(r, feSub(u1h2, x3)), feMul(s1, h3))
+	z3 := feMul(feMul(p.z, q.z), h)
+	return &point{x: x3, y: y3, z: z3}
+}
+
+// mul is k*p by double and add
+func (p *point) mul(k *big.Int) *point {
+	ret := &point{x: big.NewInt(0), y: big.NewInt(1), z: big.NewInt(0)}
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		ret = ret.double()
+		if k.Bit(i) == 1 {
+			ret = ret.add(p)
+		}
+	}
+	return ret
+}
+
+// affineX of the point, nil for infinity
+func (p *point) affineX() *big.Int {
+	if p.infinity() {
+		return nil
+	}
+	zinv := feInv(p.z)
+	return feMul(p.x, feMul(zinv, zinv))
+}
+
+// liftX returns a point with the x coordinate, the sign of y does not
+// matter for the x-only ecdh
+func liftX(x *big.Int) (*point, bool) {
+	y := feSqrt(curveY2(x))
+	if y == nil {
+		return nil, false
+	}
+	return &point{x: x, y: y, z: big.NewInt(1)}, true
+}
+
+// xswiftec decodes field elements (u, t) to an x coordinate on the curve
+func xswiftec(u, t *big.Int) *big.Int {
+	if u.Sign() == 0 {
+		u = big.NewInt(1)
+	}
+	if t.Sign() == 0 {
+		t = big.NewInt(1)
+	}
+	u3 := feMul(feMul(u, u), u)
+	if feAdd(feAdd(u3, feMul(t, t)), big.NewInt(7)).Sign() == 0 {
+		t = feAdd(t, t)
+	}
+	// X = (u^3 + 7 - t^2) / (2t), Y = (X + t) / (sqrt(-3) * u)
+	x := feDiv(feSub(feAdd(u3, big.NewInt(7)), feMul(t, t)), feAdd(t, t))
+	y := feDiv(feAdd(x, t), feMul(sqrtMinus3, u))
+	half := feInv(big.NewInt(2))
+	candidates := []*big.Int{
+		feAdd(u, feMul(big.NewInt(4), feMul(y, y))),
+		feMul(feSub(feNeg(feDiv(x, y)), u), half),
+		feMul(feSub(feDiv(x, y), u), half),
+	}
+	for _, c := range candidates {
+		if isValidX(c) {
+			return c
+		}
+	}
+	// one of the candidates is always on the curve
+	panic("bip324: xswiftec has no valid x")
+}
+
+// xswiftecInv finds t such that xswiftec(u, t) = x, nil if there is none.
+// c selects one of the up to 8 solutions.
+func xswiftecInv(x, u *big.Int, c int) *big.Int {
+	var v, s *big.Int
+	u3 := feMul(feMul(u, u), u)
+	if c&2 == 0 {
+		if isValidX(feSub(feNeg(x), u)) {
+			return nil
+		}
+		v = x
+		// s = -(u^3 + 7) / (u^2 + uv + v^2)
+		s = feNeg(feDiv(feAdd(u3, big.NewInt(7)), feAdd(feAdd(feMul(u, u), feMul(u, v)), feMul(v, v))))
+	} else {
+		s = feSub(x, u)
+		if s.Sign() == 0 {
+			return nil
+		}
+		// r = sqrt(-s * (4(u^3 + 7) + 3 s u^2))
+		in := feAdd(feMul(big.NewInt(4), feAdd(u3, big.NewInt(7))), feMul(feMul(big.NewInt(3), s), feMul(u, u)))
+		r := feSqrt(feNeg(feMul(s, in)))
+		if r == nil {
+			return nil
+		}
+		if c&1 == 1 && r.Sign() == 0 {
+			return nil
+		}
+		// v = (r/s - u) / 2
+		v = feDiv(feSub(feDiv(r, s), u), big.NewInt(2))
+	}
+	w := feSqrt(s)
+	if w == nil {
+		return nil
+	}
+	// u(1 -+ sqrt(-3))/2 + v
+	minus := feAdd(feDiv(feMul(u, feSub(big.NewInt(1), sqrtMinus3)), big.NewInt(2)), v)
+	plus := feAdd(feDiv(feMul(u, feAdd(big.NewInt(1), sqrtMinus3)), big.NewInt(2)), v)
+	switch c & 5 {
+	case 0:
+		return feNeg(feMul(w, minus))
+	case 1:
+		return feMul(w, plus)
+	case 4:
+		return feMul(w, minus)
+	default:
+		return feNeg(feMul(w, plus))
+	}
+}
+
+// Key is an ephemeral private key with its ElligatorSwift encoded public key
+type Key struct {
+	priv   *big.Int
+	Public [PubKeyLen]byte
+}
+
+// NewKey generates a key, the encoding picks random u and case
+// so the public key is indistinguishable from random bytes
+func NewKey(r io.Reader) (*Key, error) {
+	if r == nil {
+		r = rand.Reader
+	}
+	priv, err := rand.Int(r, new(big.Int).Sub(curveN, big.NewInt(1)))
+	if err != nil {
+		return nil, err
+	}
+	priv.Add(priv, big.NewInt(1))
+	g := &point{x: curveGx, y: curveGy, z: big.NewInt(1)}
+	x := g.mul(priv).affineX()
+	var buf [33]byte
+	for {
+		_, err = io.ReadFull(r, buf[:])
+		if err != nil {
+			return nil, err
+		}
+		u := fe(new(big.Int).SetBytes(buf[:32]))
+		if u.Sign() == 0 {
+			continue
+		}
+		t := xswiftecInv(x, u, int(buf[32]&7))
+		if t == nil {
+			continue
+		}
+		k := &Key{priv: priv}
+		u.FillBytes(k.Public[:32])
+		t.FillBytes(k.Public[32:])
+		return k, nil
+	}
+}
+
+// ECDH derives the shared secret from the peer public key,
+// the initiator public key goes first in the hash
+func (k *Key) ECDH(theirs [PubKeyLen]byte, initiator bool) ([32]byte, error) {
+	var secret [32]byte
+	u := fe(new(big.Int).SetBytes(theirs[:32]))
+	t := fe(new(big.Int).SetBytes(theirs[32:]))
+	p, ok := liftX(xswiftec(u, t))
+	if !ok {
+		return secret, ErrInvalidKey
+	}
+	x := p.mul(k.priv).affineX()
+	if x == nil {
+		return secret, ErrInvalidKey
+	}
+	var shared [32]byte
+	x.FillBytes(shared[:])
+	first, second := k.Public[:], theirs[:]
+	if !initiator {
+		first, second = second, first
+	}
+	return *chainhash.TaggedHash(ecdhTag, first, second, shared[:]), nil
+}
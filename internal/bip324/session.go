@@ -0,0 +1,111 @@
+package bip324
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/btcsuite/btcd/wire"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// sent after the garbage, each side has its own
+	TerminatorLen = 16
+	// garbage after the public key, up to
+	MaxGarbageLen = 4095
+	// encrypted contents length
+	LengthLen = 3
+	// header byte and the poly1305 tag around the contents
+	Overhead = 1 + chacha20poly1305.Overhead
+
+	// header bit of the decoy packets
+	ignoreBit = 0x80
+)
+
+var ErrDecrypt = errors.New("v2 packet authentication failed")
+
+// Session holds the packet ciphers of one connection
+type Session struct {
+	sendL *fsChaCha20
+	sendP *fsAEAD
+	recvL *fsChaCha20
+	recvP *fsAEAD
+
+	SendTerminator [TerminatorLen]byte
+	RecvTerminator [TerminatorLen]byte
+	// same on both sides, can be compared out of band
+	SessionID [32]byte
+}
+
+// NewSession derives the keys from the ecdh secret,
+// the network magic is a part of the salt
+func NewSession(secret [32]byte, btcnet wire.BitcoinNet, initiator bool) (*Session, error) {
+	salt := []byte("bitcoin_v2_shared_secret")
+	salt = binary.LittleEndian.AppendUint32(salt, uint32(btcnet))
+	prk := hkdf.Extract(sha256.New, secret[:], salt)
+	expand := func(info string) ([]byte, error) {
+		out := make([]byte, 32)
+		_, err := io.ReadFull(hkdf.Expand(sha256.New, prk, []byte(info)), out)
+		return out, err
+	}
+	keys := make(map[string][]byte)
+	for _, info := range []string{"initiator_L", "initiator_P", "responder_L", "responder_P", "garbage_terminators", "session_id"} {
+		key, err := expand(info)
+		if err != nil {
+			return nil, err
+		}
+		keys[info] = key
+	}
+	s := &Session{}
+	send, recv := "initiator", "responder"
+	terminators := keys["garbage_terminators"]
+	copy(s.SendTerminator[:], terminators[:TerminatorLen])
+	copy(s.RecvTerminator[:], terminators[TerminatorLen:])
+	if !initiator {
+		send, recv = recv, send
+		s.SendTerminator, s.RecvTerminator = s.RecvTerminator, s.SendTerminator
+	}
+	s.sendL = newFSChaCha20(keys[send+"_L"])
+	s.sendP = newFSAEAD(keys[send+"_P"])
+	s.recvL = newFSChaCha20(keys[recv+"_L"])
+	s.recvP = newFSAEAD(keys[recv+"_P"])
+	copy(s.SessionID[:], keys["session_id"])
+	return s, nil
+}
+
+// Encrypt returns the packet: encrypted length, header and contents.
+// aad is the sent garbage for the first packet, empty after it.
+func (s *Session) Encrypt(contents, aad []byte, ignore bool) []byte {
+	var length [LengthLen]byte
+	n := len(contents)
+	length[0], length[1], length[2] = byte(n), byte(n>>8), byte(n>>16)
+	plaintext := make([]byte, 1+len(contents))
+	if ignore {
+		plaintext[0] = ignoreBit
+	}
+	copy(plaintext[1:], contents)
+	packet := make([]byte, LengthLen, LengthLen+len(plaintext)+Overhead)
+	s.sendL.crypt(packet, length[:])
+	return append(packet, s.sendP.seal(plaintext, aad)...)
+}
+
+// DecryptLength returns the contents length of the next packet,
+// Overhead more bytes follow the length
+func (s *Session) DecryptLength(enc []byte) uint32 {
+	var length [LengthLen]byte
+	s.recvL.crypt(length[:], enc[:LengthLen])
+	return uint32(length[0]) | uint32(length[1])<<8 | uint32(length[2])<<16
+}
+
+// Decrypt authenticates the packet after the length,
+// ignore is set for decoy packets
+func (s *Session) Decrypt(packet, aad []byte) (contents []byte, ignore bool, err error) {
+	plaintext, err := s.recvP.open(packet, aad)
+	if err != nil {
+		return nil, false, ErrDecrypt
+	}
+	return plaintext[1:], plaintext[0]&ignoreBit != 0, nil
+}
@@ -0,0 +1,51 @@
+package blocks
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// Store keeps verified raw blocks, one file per block named by its hash
+type Store struct {
+	dir string
+}
+
+func NewStore(dir string) (*Store, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create blocks dir: %v", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+func (s *Store) path(hash *chainhash.Hash) string {
+	return filepath.Join(s.dir, hash.String()+".blk")
+}
+
+func (s *Store) Has(hash *chainhash.Hash) bool {
+	_, err := os.Stat(s.path(hash))
+	return err == nil
+}
+
+// Put writes the block in wire format,
+// temp file and rename so a crash does not leave a partial block
+func (s *Store) Put(hash *chainhash.Hash, raw []byte) error {
+	tmp := s.path(hash) + ".tmp"
+	err := os.WriteFile(tmp, raw, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write block %s: %v", hash, err)
+	}
+	err = os.Rename(tmp, s.path(hash))
+	if err != nil {
+		return fmt.Errorf("failed to write block %s: %v", hash, err)
+	}
+	return nil
+}
+
+// Get reads the raw block
+func (s *Store) Get(hash *chainhash.Hash) ([]byte, error) {
+	return os.ReadFile(s.path(hash))
+}
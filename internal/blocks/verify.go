@@ -0,0 +1,70 @@
+// Package blocks checks blocks downloaded from peers and archives them.
+package blocks
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/1F47E/go-btc-xray/internal/headers"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ErrInvalid is returned for blocks failing the checks, the peer sent bad data
+var ErrInvalid = errors.New("invalid block")
+
+// Verify checks the block is the requested one, its header has valid
+// proof of work and the transactions match the merkle root
+func Verify(block *wire.MsgBlock, want *chainhash.Hash, powLimit *big.Int) error {
+	hash := block.BlockHash()
+	if want != nil && hash != *want {
+		return fmt.Errorf("%w: got %s, requested %s", ErrInvalid, hash, want)
+	}
+	err := headers.CheckProofOfWork(&hash, block.Header.Bits, powLimit)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalid, hash, err)
+	}
+	if len(block.Transactions) == 0 {
+		return fmt.Errorf("%w: %s: no transactions", ErrInvalid, hash)
+	}
+	root, mutated := merkleRoot(block.Transactions)
+	if mutated {
+		return fmt.Errorf("%w: %s: duplicate transactions in the merkle tree", ErrInvalid, hash)
+	}
+	if root != block.Header.MerkleRoot {
+		return fmt.Errorf("%w: %s: merkle root mismatch, computed %s", ErrInvalid, hash, root)
+	}
+	return nil
+}
+
+// merkleRoot of the txids, odd levels duplicate the last hash.
+// mutated is set if two equal hashes are paired, CVE-2012-2459,
+// such a block has the same root as the valid one.
+func merkleRoot(txs []*wire.MsgTx) (chainhash.Hash, bool) {
+	level := make([]chainhash.Hash, len(txs))
+	for i, tx := range txs {
+		level[i] = tx.TxHash()
+	}
+	mutated := false
+	var buf [chainhash.HashSize * 2]byte
+	for len(level) > 1 {
+		for i := 0; i+1 < len(level); i += 2 {
+			if level[i] == level[i+1] {
+				mutated = true
+			}
+		}
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		next := make([]chainhash.Hash, len(level)/2)
+		for i := range next {
+			copy(buf[:chainhash.HashSize], level[2*i][:])
+			copy(buf[chainhash.HashSize:], level[2*i+1][:])
+			next[i] = chainhash.DoubleHashH(buf[:])
+		}
+		level = next
+	}
+	return level[0], mutated
+}
@@ -0,0 +1,110 @@
+package blocks
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1F47E/go-btc-xray/internal/headers"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// tx makes a distinct transaction, n goes to the signature script
+func tx(n byte) *wire.MsgTx {
+	t := wire.NewMsgTx(1)
+	t.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, 0xffffffff), []byte{n}, nil))
+	t.AddTxOut(wire.NewTxOut(50, []byte{0x51}))
+	return t
+}
+
+// block with the transactions and the merkle root of them, mined for regtest
+func block(t *testing.T, txs []*wire.MsgTx) *wire.MsgBlock {
+	t.Helper()
+	params := &chaincfg.RegressionNetParams
+	root, _ := merkleRoot(txs)
+	b := wire.NewMsgBlock(wire.NewBlockHeader(4, params.GenesisHash, &root, params.PowLimitBits, 0))
+	b.Header.Timestamp = time.Unix(1700000000, 0)
+	b.Transactions = txs
+	for ; b.Header.Nonce < 1<<20; b.Header.Nonce++ {
+		hash := b.BlockHash()
+		if headers.CheckProofOfWork(&hash, b.Header.Bits, params.PowLimit) == nil {
+			return b
+		}
+	}
+	t.Fatalf("failed to mine the block")
+	return nil
+}
+
+func TestVerifyGenesis(t *testing.T) {
+	for _, params := range []*chaincfg.Params{&chaincfg.MainNetParams, &chaincfg.TestNet3Params} {
+		err := Verify(params.GenesisBlock, params.GenesisHash, params.PowLimit)
+		if err != nil {
+			t.Errorf("%s genesis: %v", params.Name, err)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	powLimit := chaincfg.RegressionNetParams.PowLimit
+	b := block(t, []*wire.MsgTx{tx(1), tx(2), tx(3)})
+	hash := b.BlockHash()
+	if err := Verify(b, &hash, powLimit); err != nil {
+		t.Fatalf("valid block: %v", err)
+	}
+
+	other := chainhash.Hash{1}
+	if err := Verify(b, &other, powLimit); !errors.Is(err, ErrInvalid) {
+		t.Errorf("not requested block: got %v, want %v", err, ErrInvalid)
+	}
+
+	// transaction changed after the header
+	b.Transactions[1] = tx(4)
+	if err := Verify(b, nil, powLimit); !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), "merkle root mismatch") {
+		t.Errorf("changed transaction: got %v", err)
+	}
+
+	// hash above the mainnet target
+	if err := Verify(b, nil, chaincfg.MainNetParams.PowLimit); !errors.Is(err, ErrInvalid) {
+		t.Errorf("regtest pow on mainnet: got %v, want %v", err, ErrInvalid)
+	}
+}
+
+// CVE-2012-2459: the last transactions duplicated give the same merkle root,
+// the mutated block must not be accepted
+func TestVerifyMerkleMutation(t *testing.T) {
+	powLimit := chaincfg.RegressionNetParams.PowLimit
+	a, b, c := tx(1), tx(2), tx(3)
+	valid := block(t, []*wire.MsgTx{a, b, c})
+	hash := valid.BlockHash()
+
+	mutated := *valid
+	mutated.Transactions = []*wire.MsgTx{a, b, c, c}
+	root, dup := merkleRoot(mutated.Transactions)
+	if root != valid.Header.MerkleRoot || !dup {
+		t.Fatalf("mutated root %s duplicate %v, valid root %s", root, dup, valid.Header.MerkleRoot)
+	}
+	err := Verify(&mutated, &hash, powLimit)
+	if !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), "duplicate") {
+		t.Errorf("mutated block: got %v", err)
+	}
+
+	// deeper level: 6 transactions with the last pair duplicated
+	six := []*wire.MsgTx{tx(1), tx(2), tx(3), tx(4), tx(5), tx(6)}
+	valid = block(t, six)
+	hash = valid.BlockHash()
+	mutated = *valid
+	mutated.Transactions = append(append([]*wire.MsgTx(nil), six...), six[4], six[5])
+	if root, _ = merkleRoot(mutated.Transactions); root != valid.Header.MerkleRoot {
+		t.Fatalf("mutated root %s, valid root %s", root, valid.Header.MerkleRoot)
+	}
+	if err = Verify(&mutated, &hash, powLimit); !errors.Is(err, ErrInvalid) {
+		t.Errorf("mutated block: got %v, want %v", err, ErrInvalid)
+	}
+	if err = Verify(valid, &hash, powLimit); err != nil {
+		t.Errorf("valid block: %v", err)
+	}
+}
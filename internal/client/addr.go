@@ -0,0 +1,55 @@
+package client
+
+import (
+	"sort"
+)
+
+// AddrPeer is how many addresses one good node gave us
+type AddrPeer struct {
+	Endpoint string `json:"endpoint"`
+	Response int    `json:"response"`
+	Relayed  int    `json:"relayed"`
+	Self     bool   `json:"self,omitempty"`
+}
+
+// AddrReport summarizes the addr harvest over the good nodes
+type AddrReport struct {
+	Nodes int `json:"nodes"`
+	// nodes that answered on getaddr with a big addr message
+	Responded int `json:"responded"`
+	// nodes that announced their own address
+	SelfAnnounced int `json:"self_announced"`
+	Response      int `json:"response"`
+	Relayed       int `json:"relayed"`
+	// sorted by the getaddr answer size
+	Peers []AddrPeer `json:"peers"`
+}
+
+func (c *Client) AddrReport() *AddrReport {
+	r := &AddrReport{Peers: make([]AddrPeer, 0)}
+	for _, n := range c.GoodNodes() {
+		s := n.AddrStats()
+		r.Nodes++
+		if s.Messages == 0 {
+			continue
+		}
+		if s.Response > 0 {
+			r.Responded++
+		}
+		if s.Self {
+			r.SelfAnnounced++
+		}
+		r.Response += s.Response
+		r.Relayed += s.Relayed
+		r.Peers = append(r.Peers, AddrPeer{
+			Endpoint: n.EndpointSafe(),
+			Response: s.Response,
+			Relayed:  s.Relayed,
+			Self:     s.Self,
+		})
+	}
+	sort.Slice(r.Peers, func(i, j int) bool {
+		return r.Peers[i].Response > r.Peers[j].Response
+	})
+	return r
+}
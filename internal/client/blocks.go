@@ -0,0 +1,40 @@
+package client
+
+import (
+	"github.com/1F47E/go-btc-xray/internal/client/node"
+)
+
+// BlocksReport shows which full nodes really serve the requested blocks
+type BlocksReport struct {
+	// peers asked for the blocks
+	Peers int `json:"peers"`
+	node.BlockStats
+	// endpoints of the peers that did not serve or sent bad blocks
+	MissingBy []string `json:"missing_by,omitempty"`
+	InvalidBy []string `json:"invalid_by,omitempty"`
+}
+
+// BlocksReport returns nil if no blocks are requested
+func (c *Client) BlocksReport() *BlocksReport {
+	if c.blocks == nil {
+		return nil
+	}
+	r := &BlocksReport{}
+	for _, n := range c.GoodNodes() {
+		stats := n.BlockStats()
+		if stats == (node.BlockStats{}) {
+			continue
+		}
+		r.Peers++
+		r.Served += stats.Served
+		r.Missing += stats.Missing
+		r.Invalid += stats.Invalid
+		if stats.Missing > 0 {
+			r.MissingBy = append(r.MissingBy, n.EndpointSafe())
+		}
+		if stats.Invalid > 0 {
+			r.InvalidBy = append(r.InvalidBy, n.EndpointSafe())
+		}
+	}
+	return r
+}
@@ -0,0 +1,43 @@
+package client
+
+import (
+	"github.com/1F47E/go-btc-xray/internal/headers"
+)
+
+// ChainReport is the header chain tip and how the good nodes compare to it
+type ChainReport struct {
+	Tip headers.Header `json:"tip"`
+	// good nodes by chain status, unknown ones are under ""
+	Statuses map[headers.Status]int `json:"statuses"`
+	// endpoints of the flagged nodes
+	Lagging   []string `json:"lagging,omitempty"`
+	StaleFork []string `json:"stale_fork,omitempty"`
+	Lying     []string `json:"lying,omitempty"`
+	Invalid   []string `json:"invalid,omitempty"`
+}
+
+// ChainReport returns nil if header sync is disabled
+func (c *Client) ChainReport() *ChainReport {
+	if c.chain == nil {
+		return nil
+	}
+	r := &ChainReport{
+		Tip:      c.chain.Tip(),
+		Statuses: make(map[headers.Status]int),
+	}
+	for _, n := range c.GoodNodes() {
+		status := n.ChainStatus()
+		r.Statuses[status]++
+		switch status {
+		case headers.StatusLagging:
+			r.Lagging = append(r.Lagging, n.EndpointSafe())
+		case headers.StatusStaleFork:
+			r.StaleFork = append(r.StaleFork, n.EndpointSafe())
+		case headers.StatusLying:
+			r.Lying = append(r.Lying, n.EndpointSafe())
+		case headers.StatusInvalid:
+			r.Invalid = append(r.Invalid, n.EndpointSafe())
+		}
+	}
+	return r
+}
@@ -10,29 +10,52 @@ package client
 import (
 	"context"
 	"math/rand"
+	"path/filepath"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/1F47E/go-btc-xray/internal/blocks"
 	"github.com/1F47E/go-btc-xray/internal/client/node"
 	"github.com/1F47E/go-btc-xray/internal/config"
+	"github.com/1F47E/go-btc-xray/internal/geoip"
 	"github.com/1F47E/go-btc-xray/internal/gui"
+	"github.com/1F47E/go-btc-xray/internal/headers"
 	"github.com/1F47E/go-btc-xray/internal/logger"
+	"github.com/1F47E/go-btc-xray/internal/observe"
+	"github.com/1F47E/go-btc-xray/internal/seeds"
+	"github.com/1F47E/go-btc-xray/internal/storage"
 )
 
-var cfg = config.New()
-
 type Client struct {
 	mu   sync.Mutex
 	ctx  context.Context
 	exit context.CancelFunc
+	cfg  *config.Config
 	log  *logger.Logger
 
+	// nodes file and reports of the network
+	storage *storage.Storage
+
+	// optional offline geoip enrichment of good nodes
+	geo *geoip.GeoIP
+
 	// nodes storage
 	nodes     map[string]*node.Node
 	nodesNew  []*node.Node
 	nodesGood []*node.Node
 
+	// re-verify good nodes with this interval, 0 disables
+	recheck time.Duration
+
+	// validated header chain, nil if header sync is disabled
+	chain *headers.Chain
+	// archive of downloaded blocks, nil if no blocks are requested
+	blocks *blocks.Store
+	// inv announcements recorder, nil if observation is disabled
+	observer *observe.Observer
+
 	// atomic counters
 	nodesDeadCnt int32
 	activeConns  int32
@@ -44,7 +67,7 @@ type Client struct {
 	newAddrCh chan []string
 }
 
-func NewClient(ctx context.Context, log *logger.Logger, guiCh chan gui.IncomingData) *Client {
+func NewClient(ctx context.Context, cfg *config.Config, log *logger.Logger, guiCh chan gui.IncomingData) *Client {
 	// client context to stop the client but not the gui
 	// TODO: exit if no gui
 	cliCtx, cancel := context.WithCancel(ctx)
@@ -54,8 +77,11 @@ func NewClient(ctx context.Context, log *logger.Logger, guiCh chan gui.IncomingD
 
 		// called when the is no new nodes anymore to stop all the client workers
 		exit: cancel,
+		cfg:  cfg,
 		log:  log,
 
+		storage: storage.New(cfg),
+
 		// keeping all the nodes in a map for quick check for duplicates
 		nodes: make(map[string]*node.Node),
 
@@ -79,6 +105,37 @@ func NewClient(ctx context.Context, log *logger.Logger, guiCh chan gui.IncomingD
 		// then they will be proccessed by the worker wNewAddrListner
 		newAddrCh: make(chan []string, cfg.ConnectionsLimit),
 	}
+	if cfg.HeaderSync {
+		c.chain = headers.New(cfg.Params, headers.Rules{NoRetarget: cfg.PowNoRetarget, EnforceBIP94: cfg.EnforceBIP94})
+	}
+	if len(cfg.Blocks) > 0 {
+		store, err := blocks.NewStore(filepath.Join(cfg.BlocksDir, string(cfg.Name)))
+		if err != nil {
+			log.Errorf("[CLIENT]: block download disabled: %v\n", err)
+		} else {
+			c.blocks = store
+		}
+	}
+	if cfg.Observe {
+		events := ""
+		if cfg.ObserveEvents {
+			events = c.storage.Path("inv.jsonl")
+		}
+		observer, err := observe.New(events)
+		if err != nil {
+			log.Errorf("[CLIENT]: observation disabled: %v\n", err)
+		} else {
+			c.observer = observer
+		}
+	}
+	if cfg.GeoCountryDB != "" || cfg.GeoCityDB != "" || cfg.GeoASNDB != "" {
+		geo, err := geoip.New(cfg.GeoCountryDB, cfg.GeoCityDB, cfg.GeoASNDB)
+		if err != nil {
+			log.Errorf("[CLIENT]: geoip disabled: %v\n", err)
+		} else {
+			c.geo = geo
+		}
+	}
 	return &c
 }
 
@@ -98,8 +155,18 @@ func (c *Client) Start() {
 	// feed the queue with new nodes
 	go c.wNodesFeeder()
 
+	// save propagation stats and flush the events log
+	if c.observer != nil {
+		go c.wObserveSaver()
+	}
+
+	// re-verify good nodes periodically
+	if c.recheck > 0 {
+		go c.wNodesRechecker()
+	}
+
 	// start a worker pool to connect to the nodes
-	for i := 0; i < cfg.ConnectionsLimit; i++ {
+	for i := 0; i < c.cfg.ConnectionsLimit; i++ {
 		i := i
 		go c.wNodesConnector(i)
 	}
@@ -116,19 +183,47 @@ func (c *Client) Disconnect() {
 		}
 	}
 	c.log.Debugf("[CLIENT]: disconnected %d nodes\n", cnt)
+	if c.geo != nil {
+		_ = c.geo.Close()
+	}
+	if c.observer != nil {
+		_ = c.observer.Close()
+		_ = c.storage.SaveReport("propagation", c.observer.Report())
+		_ = c.storage.SaveReport("blockrace", c.observer.RaceReport())
+	}
 }
 
 func (c *Client) AddNodes(ips []string) {
+	c.AddSeedNodes("", ips)
+}
+
+// AddSeedNodes adds nodes tagged with the bootstrap source they came from.
+// Tags are used for the per seed quality report.
+func (c *Client) AddSeedNodes(seed string, ips []string) {
 	c.log.Debugf("[CLIENT]: got batch of %d nodes\n", len(ips))
 	cnt := 1
 	c.mu.Lock()
 	for _, ip := range ips {
-		if _, ok := c.nodes[ip]; ok {
+		// accepts ip, ip:port and [ip]:port, skips tor and other networks
+		a, err := seeds.ParseEndpoint(ip, c.cfg.NodesPort)
+		if err != nil || a.IP == nil {
+			continue
+		}
+		key := a.Endpoint()
+		if n, ok := c.nodes[key]; ok {
+			if seed != "" {
+				n.AddSeed(seed)
+			}
 			continue
 		}
-		n := node.NewNode(c.log, ip, c.newAddrCh)
+		n := node.NewNode(c.cfg, c.log, a.IP.String(), a.Port, c.newAddrCh, c.chain, c.blocks, c.observer)
+		// advertise the chain height seen from the peers
+		n.SetHeightSource(c.BestHeight)
+		if seed != "" {
+			n.AddSeed(seed)
+		}
 		// add new nodes to the all nodes map but also to the queue
-		c.nodes[ip] = n
+		c.nodes[key] = n
 		c.nodesNew = append(c.nodesNew, n)
 		cnt++
 	}
@@ -141,6 +236,41 @@ func (c *Client) AddNodes(ips []string) {
 	c.log.Debugf("[CLIENT]: got %d nodes from %d batch\n", cnt, len(ips))
 }
 
+// EnableRecheck makes the client reconnect to the good nodes
+// verified longer than interval ago, should be called before Start
+func (c *Client) EnableRecheck(interval time.Duration) {
+	c.recheck = interval
+}
+
+// GoodNodes returns a copy of the good nodes list
+func (c *Client) GoodNodes() []*node.Node {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ret := make([]*node.Node, len(c.nodesGood))
+	copy(ret, c.nodesGood)
+	return ret
+}
+
+// BestHeight is the validated header tip with the header sync,
+// otherwise the median start height claimed by the good nodes,
+// lying or lagging peers do not move it
+func (c *Client) BestHeight() int32 {
+	if c.chain != nil && c.chain.Height() > 0 {
+		return c.chain.Height()
+	}
+	c.mu.Lock()
+	heights := make([]int32, 0, len(c.nodesGood))
+	for _, n := range c.nodesGood {
+		heights = append(heights, n.Height())
+	}
+	c.mu.Unlock()
+	if len(heights) == 0 {
+		return c.cfg.Version.StartHeight
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	return heights[len(heights)/2]
+}
+
 func (c *Client) ActiveConns() int {
 	return int(atomic.LoadInt32(&c.activeConns))
 }
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"fmt"
+)
+
+// FeaturesReport counts the optional features signaled by the good nodes
+type FeaturesReport struct {
+	Nodes       int `json:"nodes"`
+	SendHeaders int `json:"sendheaders"`
+	FeeFilter   int `json:"feefilter"`
+	SendAddrV2  int `json:"sendaddrv2"`
+	WtxidRelay  int `json:"wtxidrelay"`
+	// by compact blocks version, "v2" and "v2_hb" for high bandwidth
+	SendCmpct map[string]int `json:"sendcmpct"`
+	// nodes sending the command we do not understand
+	Unknown map[string]int `json:"unknown"`
+	// nodes by transport, v2 accepted the BIP 324 encrypted one
+	Transport map[string]int `json:"transport"`
+}
+
+func (c *Client) FeaturesReport() *FeaturesReport {
+	r := &FeaturesReport{
+		SendCmpct: make(map[string]int),
+		Unknown:   make(map[string]int),
+		Transport: make(map[string]int),
+	}
+	for _, n := range c.GoodNodes() {
+		f := n.Features()
+		r.Nodes++
+		if f.SendHeaders {
+			r.SendHeaders++
+		}
+		if f.FeeFilter != nil {
+			r.FeeFilter++
+		}
+		if f.SendAddrV2 {
+			r.SendAddrV2++
+		}
+		if f.WtxidRelay {
+			r.WtxidRelay++
+		}
+		for _, v := range f.SendCmpct {
+			key := fmt.Sprintf("v%d", v.Version)
+			if v.Announce {
+				key += "_hb"
+			}
+			r.SendCmpct[key]++
+		}
+		for _, command := range f.Unknown {
+			r.Unknown[command]++
+		}
+		if t := n.Transport(); t != "" {
+			r.Transport[t]++
+		}
+	}
+	return r
+}
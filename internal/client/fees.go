@@ -0,0 +1,39 @@
+package client
+
+import (
+	"time"
+
+	"github.com/1F47E/go-btc-xray/internal/fees"
+)
+
+// FeesReport is the relay policy of the good nodes
+type FeesReport struct {
+	Time  time.Time `json:"time"`
+	Nodes int       `json:"nodes"`
+	// relay flag from version, blocks only nodes do not want transactions
+	Relay   int `json:"relay"`
+	NoRelay int `json:"no_relay"`
+	// latest feefilter of every node that sent one, sat/kvB
+	FeeFilter *fees.Summary `json:"feefilter"`
+}
+
+func (c *Client) FeesReport() *FeesReport {
+	r := &FeesReport{Time: time.Now()}
+	values := make([]int64, 0)
+	for _, n := range c.GoodNodes() {
+		if !n.HasVersion() {
+			continue
+		}
+		r.Nodes++
+		if n.Relay() {
+			r.Relay++
+		} else {
+			r.NoRelay++
+		}
+		if fee := n.Features().FeeFilter; fee != nil {
+			values = append(values, *fee)
+		}
+	}
+	r.FeeFilter = fees.Summarize(values)
+	return r
+}
@@ -0,0 +1,71 @@
+package node
+
+import (
+	"net"
+)
+
+// AddrStats counts the addresses the peer gave us over all the connections
+type AddrStats struct {
+	Messages int `json:"messages"`
+	// addresses in the answers on our getaddr
+	Response int `json:"response"`
+	// small unsolicited addr messages, relayed addresses
+	Relayed int `json:"relayed"`
+	// peer announced its own address
+	Self bool `json:"self,omitempty"`
+}
+
+// Core relays at most 10 addresses in unsolicited messages,
+// bigger messages after our getaddr are the answer on it
+const maxRelayedAddrs = 10
+
+func (n *Node) AddrStats() AddrStats {
+	n.addrMu.Lock()
+	defer n.addrMu.Unlock()
+	return n.addrStats
+}
+
+// resetHarvest starts a new harvest on connect
+func (n *Node) resetHarvest() {
+	n.addrMu.Lock()
+	defer n.addrMu.Unlock()
+	n.harvestDone = make(chan struct{})
+	n.harvestClosed = false
+	n.harvested = 0
+	n.responded = false
+}
+
+// addAddrs classifies one addr message by the hosts in it and closes
+// harvestDone when the harvest policy is satisfied:
+// ADDR_TARGET addresses or the getaddr answer if there is no target
+func (n *Node) addAddrs(hosts []string) {
+	n.addrMu.Lock()
+	defer n.addrMu.Unlock()
+	s := &n.addrStats
+	s.Messages++
+	peer := net.ParseIP(n.ip)
+	others := 0
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil && ip.Equal(peer) {
+			s.Self = true
+			continue
+		}
+		others++
+	}
+	if n.askedAddr() && len(hosts) > maxRelayedAddrs {
+		s.Response += others
+		n.responded = true
+	} else {
+		s.Relayed += others
+	}
+	n.harvested += others
+
+	done := n.responded
+	if n.cfg.AddrTarget > 0 {
+		done = n.harvested >= n.cfg.AddrTarget
+	}
+	if done && !n.harvestClosed {
+		n.harvestClosed = true
+		close(n.harvestDone)
+	}
+}
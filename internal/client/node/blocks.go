@@ -0,0 +1,163 @@
+package node
+
+import (
+	"context"
+	"time"
+
+	"github.com/1F47E/go-btc-xray/internal/blocks"
+	"github.com/1F47E/go-btc-xray/internal/cmd"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// blockReply is a block or a notfound answer on our getdata
+type blockReply struct {
+	block *wire.MsgBlock
+	// block in wire format as received
+	raw      []byte
+	notFound []*wire.InvVect
+}
+
+// BlockStats counts answers on the block requests
+type BlockStats struct {
+	Served int `json:"served"`
+	// notfound or no answer in time
+	Missing int `json:"missing"`
+	// failed the merkle root or proof of work check
+	Invalid int `json:"invalid"`
+}
+
+func (n *Node) BlockStats() BlockStats {
+	n.stateMu.RLock()
+	defer n.stateMu.RUnlock()
+	return n.blockStats
+}
+
+func (n *Node) countBlock(answer blockAnswer) {
+	n.stateMu.Lock()
+	defer n.stateMu.Unlock()
+	switch answer {
+	case blockServed:
+		n.blockStats.Served++
+	case blockMissing:
+		n.blockStats.Missing++
+	case blockInvalid:
+		n.blockStats.Invalid++
+	}
+}
+
+// blockHashes resolves the configured blocks,
+// heights above our header tip are skipped
+func (n *Node) blockHashes() []chainhash.Hash {
+	ret := make([]chainhash.Hash, 0)
+	for _, ref := range n.cfg.Blocks {
+		if ref.Hash != nil {
+			ret = append(ret, *ref.Hash)
+			continue
+		}
+		if n.chain == nil {
+			continue
+		}
+		for height := ref.From; height <= ref.To; height++ {
+			hash, ok := n.chain.HashAt(height)
+			if !ok {
+				break
+			}
+			ret = append(ret, hash)
+		}
+	}
+	return ret
+}
+
+// blockAnswer is how the peer answered on a block request
+type blockAnswer int
+
+const (
+	blockServed blockAnswer = iota
+	// notfound or no answer in time
+	blockMissing
+	blockInvalid
+	// connection or context is done
+	blockClosed
+)
+
+// fetchBlocks asks the peer for the configured blocks one by one,
+// verified blocks are archived to the store
+func (n *Node) fetchBlocks(ctx context.Context, a string) {
+	for _, hash := range n.blockHashes() {
+		hash := hash
+		answer, reply := n.getBlock(ctx, a, &hash)
+		if answer == blockClosed {
+			return
+		}
+		n.countBlock(answer)
+		if answer != blockServed {
+			continue
+		}
+		if n.blocks.Has(&hash) {
+			continue
+		}
+		err := n.blocks.Put(&hash, reply.raw)
+		if err != nil {
+			n.log.Errorf("%s %v", a, err)
+			continue
+		}
+		n.log.Infof("%s block %s archived, %d bytes\n", a, hash, len(reply.raw))
+	}
+}
+
+// getBlock requests one block and verifies the answer
+func (n *Node) getBlock(ctx context.Context, a string, hash *chainhash.Hash) (blockAnswer, *blockReply) {
+	invType := wire.InvTypeBlock
+	if n.Services()&wire.SFNodeWitness != 0 {
+		invType = wire.InvTypeWitnessBlock
+	}
+	n.log.Debugf("%s sending getdata block %s...\n", a, hash)
+	err := cmd.SendGetData(n.conn, n.Pver(), []*wire.InvVect{wire.NewInvVect(invType, hash)})
+	if err != nil {
+		n.log.Errorf("%s failed to write getdata: %v", a, err)
+		return blockClosed, nil
+	}
+	reply, ok := n.waitBlock(ctx, hash)
+	if !ok {
+		return blockClosed, nil
+	}
+	if reply == nil {
+		n.log.Warnf("%s block %s not served\n", a, hash)
+		return blockMissing, nil
+	}
+	err = blocks.Verify(reply.block, hash, n.cfg.Params.PowLimit)
+	if err != nil {
+		n.log.Warnf("%s %v\n", a, err)
+		return blockInvalid, nil
+	}
+	return blockServed, reply
+}
+
+// waitBlock returns nil reply on notfound or timeout,
+// ok is false if the connection or the context is done
+func (n *Node) waitBlock(ctx context.Context, hash *chainhash.Hash) (*blockReply, bool) {
+	timeout := time.NewTimer(n.cfg.BlocksTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case reply := <-n.blockCh:
+			if reply.block != nil && reply.block.BlockHash() == *hash {
+				return reply, true
+			}
+			for _, inv := range reply.notFound {
+				if inv.Hash == *hash {
+					return nil, true
+				}
+			}
+			// some other block or notfound, keep waiting
+		case <-timeout.C:
+			return nil, true
+		case <-n.listenDone:
+			return nil, false
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
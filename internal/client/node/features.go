@@ -0,0 +1,108 @@
+package node
+
+import (
+	"sort"
+	"time"
+
+	"github.com/1F47E/go-btc-xray/internal/fees"
+)
+
+// CmpctVersion is one sendcmpct message, BIP 152
+type CmpctVersion struct {
+	Version uint64 `json:"version"`
+	// high bandwidth mode, blocks are pushed as cmpctblock
+	Announce bool `json:"announce"`
+}
+
+// Features the peer signaled after the handshake
+type Features struct {
+	SendHeaders bool `json:"sendheaders,omitempty"` // BIP 130
+	// min fee rate sat/kvB, nil if feefilter was not sent, BIP 133
+	FeeFilter  *int64         `json:"feefilter,omitempty"`
+	SendCmpct  []CmpctVersion `json:"sendcmpct,omitempty"`  // BIP 152
+	SendAddrV2 bool           `json:"sendaddrv2,omitempty"` // BIP 155
+	WtxidRelay bool           `json:"wtxidrelay,omitempty"` // BIP 339
+	// commands we do not understand, sorted
+	Unknown []string `json:"unknown,omitempty"`
+}
+
+// Features returns a copy of the features signaled by the peer
+func (n *Node) Features() Features {
+	n.featMu.Lock()
+	defer n.featMu.Unlock()
+	f := n.features
+	f.SendCmpct = append([]CmpctVersion(nil), f.SendCmpct...)
+	f.Unknown = append([]string(nil), f.Unknown...)
+	if f.FeeFilter != nil {
+		fee := *f.FeeFilter
+		f.FeeFilter = &fee
+	}
+	return f
+}
+
+// updateFeatures is called by the listener
+func (n *Node) updateFeatures(update func(f *Features)) {
+	n.featMu.Lock()
+	defer n.featMu.Unlock()
+	update(&n.features)
+}
+
+func (f *Features) addCmpct(v CmpctVersion) {
+	for i, c := range f.SendCmpct {
+		if c.Version == v.Version {
+			f.SendCmpct[i] = v
+			return
+		}
+	}
+	f.SendCmpct = append(f.SendCmpct, v)
+}
+
+// unknown commands kept per peer
+const maxUnknown = 16
+
+func (f *Features) addUnknown(command string) {
+	i := sort.SearchStrings(f.Unknown, command)
+	if i < len(f.Unknown) && f.Unknown[i] == command {
+		return
+	}
+	if len(f.Unknown) >= maxUnknown {
+		return
+	}
+	f.Unknown = append(f.Unknown, "")
+	copy(f.Unknown[i+1:], f.Unknown[i:])
+	f.Unknown[i] = command
+}
+
+// empty reports whether nothing was signaled
+func (f *Features) empty() bool {
+	return !f.SendHeaders && f.FeeFilter == nil && len(f.SendCmpct) == 0 &&
+		!f.SendAddrV2 && !f.WtxidRelay && len(f.Unknown) == 0
+}
+
+// feefilter values kept per node
+const maxFeeSamples = 16
+
+func (n *Node) addFeeFilter(t time.Time, fee int64) {
+	n.featMu.Lock()
+	defer n.featMu.Unlock()
+	n.features.FeeFilter = &fee
+	n.feeFilters = append(n.feeFilters, fees.Sample{Time: t, Fee: fee})
+	if len(n.feeFilters) > maxFeeSamples {
+		n.feeFilters = n.feeFilters[len(n.feeFilters)-maxFeeSamples:]
+	}
+}
+
+// FeeFilters returns a copy of the received feefilter values, oldest first
+func (n *Node) FeeFilters() []fees.Sample {
+	n.featMu.Lock()
+	defer n.featMu.Unlock()
+	return append([]fees.Sample(nil), n.feeFilters...)
+}
+
+// Relay is the transactions relay flag from version,
+// nodes running with blocksonly do not want transactions
+func (n *Node) Relay() bool {
+	n.stateMu.RLock()
+	defer n.stateMu.RUnlock()
+	return n.relay
+}
@@ -0,0 +1,93 @@
+package node
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/1F47E/go-btc-xray/internal/cmd"
+)
+
+// Pver returns protocol version negotiated with the peer
+func (n *Node) Pver() uint32 {
+	return atomic.LoadUint32(&n.pver)
+}
+
+func (n *Node) setPver(pver uint32) {
+	atomic.StoreUint32(&n.pver, pver)
+}
+
+// negotiate does the version handshake.
+// Feature messages are sent only if the negotiated version supports them:
+// wtxidrelay and sendaddrv2 before verack, sendheaders and feefilter after.
+func (n *Node) negotiate(a string) error {
+	// 1. sending version
+	n.log.Debugf("%s sending version...\n", a)
+	height := n.cfg.Version.StartHeight
+	if n.cfg.Version.StartHeightAuto && n.heightSource != nil {
+		height = n.heightSource()
+	}
+	err := cmd.SendVersion(n.conn, n.cfg.Pver, n.cfg.Version, n.pingNonce, height)
+	if err != nil {
+		return fmt.Errorf("%s failed to write version: %v", a, err)
+	}
+	n.log.Debugf("%s OK\n", a)
+
+	// 2. wait for their version, listener negotiates the protocol version
+	select {
+	case <-n.versionCh:
+	case <-time.After(n.cfg.NodeTimeout):
+		return fmt.Errorf("%s version timeout", a)
+	}
+	pver := n.Pver()
+	n.log.Debugf("%s negotiated protocol version %d (ours %d, theirs %d)\n", a, pver, n.cfg.Pver, n.Version())
+
+	// 3. features announced before verack
+	if n.cfg.WtxidRelay && pver >= cmd.WtxidRelayVersion {
+		n.log.Debugf("%s sending wtxidrelay...\n", a)
+		err = cmd.SendWtxidRelay(n.conn, pver)
+		if err != nil {
+			return fmt.Errorf("%s failed to write wtxidrelay: %v", a, err)
+		}
+	}
+	if pver >= cmd.AddrV2Version {
+		n.log.Debugf("%s sending sendaddrv2...\n", a)
+		err = cmd.SendAddrV2(n.conn, pver)
+		if err != nil {
+			return fmt.Errorf("%s failed to write sendaddrv2: %v", a, err)
+		}
+	}
+
+	// 4. send verAck
+	n.log.Debugf("%s sending verack...\n", a)
+	err = cmd.SendVerAck(n.conn, pver)
+	if err != nil {
+		return fmt.Errorf("%s failed to write verack: %v", a, err)
+	}
+	n.log.Debugf("%s OK\n", a)
+
+	// 5. features announced after verack
+	if n.cfg.SendHeaders && pver >= cmd.SendHeadersVersion {
+		n.log.Debugf("%s sending sendheaders...\n", a)
+		err = cmd.SendHeaders(n.conn, pver)
+		if err != nil {
+			return fmt.Errorf("%s failed to write sendheaders: %v", a, err)
+		}
+	}
+	// high bandwidth mode, peers push new blocks as cmpctblock
+	if n.observer != nil && pver >= cmd.SendCmpctVersion {
+		n.log.Debugf("%s sending sendcmpct...\n", a)
+		err = cmd.SendCmpct(n.conn, pver, true, 2)
+		if err != nil {
+			return fmt.Errorf("%s failed to write sendcmpct: %v", a, err)
+		}
+	}
+	if n.cfg.FeeFilter > 0 && pver >= cmd.FeeFilterVersion {
+		n.log.Debugf("%s sending feefilter...\n", a)
+		err = cmd.SendFeeFilter(n.conn, pver, n.cfg.FeeFilter)
+		if err != nil {
+			return fmt.Errorf("%s failed to write feefilter: %v", a, err)
+		}
+	}
+	return nil
+}
@@ -2,128 +2,202 @@ package node
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"time"
 
+	"github.com/1F47E/go-btc-xray/internal/cmd"
+	"github.com/1F47E/go-btc-xray/internal/observe"
+
 	"github.com/btcsuite/btcd/wire"
 )
 
 // listen to incoming messages
+// reads until the connection is closed, Connect closes it on exit
 func (n *Node) listen(ctx context.Context) {
 	a := fmt.Sprintf("◀︎ %s", n.Endpoint())
-	ticker := time.NewTicker(cfg.ListenInterval)
+	conn := n.conn
 	defer func() {
 		// ensure to close the connection on exit
-		if n.conn != nil {
-			n.conn.Close()
+		if conn != nil {
+			conn.Close()
 		}
-		n.status = disconnected
+		n.setStatus(disconnected)
+		close(n.listenDone)
 		n.log.Warnf("%s closed\n", a)
-		ticker.Stop()
 	}()
 	// exit listener if no connection
-	if n.conn == nil {
+	if conn == nil {
 		return
 	}
 	for {
-		select {
-		case <-ctx.Done():
+		if ctx.Err() != nil || n.getStatus() != connected {
 			return
-		case <-ticker.C:
-			// do not connect if no connection, will panic
-			if n.conn == nil || n.status != connected {
+		}
+		// commands btcd does not know come as cmd types or cmd.MsgUnknown
+		cnt, msg, rawPayload, err := conn.ReadMessage(n.Pver())
+		// receive time for the announcements
+		received := time.Now()
+		if err != nil {
+			if err == io.EOF {
+				n.log.Warnf("%s EOF, exit\n", a)
 				return
 			}
-			cnt, msg, rawPayload, err := wire.ReadMessageN(n.conn, cfg.Pver, cfg.Btcnet)
-			// cnt, msg, rawPayload, err := wire.ReadMessageWithEncodingN(n.Conn, cfg.Pver, cfg.Btcnet, wire.BaseEncoding)
+			// payload was read but failed to decode, the stream is still in sync
+			var msgErr *wire.MessageError
+			if errors.As(err, &msgErr) {
+				n.log.Warnf("%s ERR: bad message, ignoring: %v\n", a, err)
+				n.log.Debugf("%s ERR: bytes read: %v, rawPayload: %v\n", a, cnt, rawPayload)
+				continue
+			}
+			// closed, reset or timed out
+			n.log.Warnf("%s ERR: Cant read buffer, error: %v\n", a, err)
+			return
+		}
+		n.log.Debugf("%s Got message: %d bytes, cmd: %s rawPayload len: %d\n", a, cnt, msg.Command(), len(rawPayload))
+		switch m := msg.(type) {
+		case *wire.MsgVersion:
+			n.log.Infof("%s MsgVersion received\n", a)
+			n.log.Debugf("%s version: %v\n", a, m.ProtocolVersion)
+			n.log.Debugf("%s msg: %+v\n", a, m)
+			n.setVersion(m, received)
+			// encode and decode with the version both sides understand
+			n.setPver(cmd.Negotiate(n.cfg.Pver, m.ProtocolVersion))
+			select {
+			case n.versionCh <- struct{}{}:
+			default:
+			}
+
+		case *wire.MsgVerAck:
+			n.log.Infof("%s MsgVerAck received\n", a)
+			n.log.Debugf("%s msg: %+v\n", a, m)
+
+		case *wire.MsgPing:
+			n.log.Infof("%s MsgPing received\n", a)
+			n.log.Debugf("%s nonce: %v\n", a, m.Nonce)
+			n.log.Debugf("%s msg: %+v\n", a, m)
+			err = cmd.SendPong(conn, n.Pver(), m.Nonce)
 			if err != nil {
-				if err == io.EOF {
-					n.log.Warnf("%s EOF, exit\n", a)
-					return
-				}
-				// Since the protocol version is 70016 but we don't
-				// implement compact blocks, we have to ignore unknown
-				// messages after the version-verack handshake. This
-				// matches bitcoind's behavior and is necessary since
-				// compact blocks negotiation occurs after the
-				// handshake.
-				if err == wire.ErrUnknownMessage {
-					n.log.Warnf("%s ERR: unknown message, ignoring\n", a)
-					continue
-				}
+				n.log.Warnf("%s failed to write pong: %v\n", a, err)
+			}
 
-				// log.Fatalf("Cant read buffer, error: %v\n", err)
-				n.log.Warnf("%s ERR: Cant read buffer, error: %v\n", a, err)
-				n.log.Warnf("%s ERR: bytes read: %v\n", a, cnt)
-				n.log.Warnf("%s ERR: msg: %v\n", a, msg)
-				n.log.Warnf("%s ERR: rawPayload: %v\n", a, rawPayload)
-				continue
+		case *wire.MsgPong:
+			n.log.Infof("%s MsgPong received\n", a)
+			if m.Nonce == n.pingNonce {
+				n.log.Debugf("%s pong OK\n", a)
+				n.pong(received)
+				n.pongCount++
+				n.UpdatePingNonce()
+			} else {
+				n.log.Warnf("%s pong nonce mismatch, expected %v, got %v\n", a, n.pingNonce, m.Nonce)
 			}
-			n.log.Debugf("%s Got message: %d bytes, cmd: %s rawPayload len: %d\n", a, cnt, msg.Command(), len(rawPayload))
-			switch m := msg.(type) {
-			case *wire.MsgVersion:
-				n.log.Infof("%s MsgVersion received\n", a)
-				n.log.Debugf("%s version: %v\n", a, m.ProtocolVersion)
-				n.log.Debugf("%s msg: %+v\n", a, m)
-				n.version = m.ProtocolVersion
-
-			case *wire.MsgVerAck:
-				n.log.Infof("%s MsgVerAck received\n", a)
-				n.log.Debugf("%s msg: %+v\n", a, m)
-
-			case *wire.MsgPing:
-				n.log.Infof("%s MsgPing received\n", a)
-				n.log.Debugf("%s nonce: %v\n", a, m.Nonce)
-				n.log.Debugf("%s msg: %+v\n", a, m)
-
-			case *wire.MsgPong:
-				n.log.Infof("%s MsgPong received\n", a)
-				if m.Nonce == n.pingNonce {
-					n.log.Debugf("%s pong OK\n", a)
-					n.pongCount++
-					n.UpdatePingNonce()
-				} else {
-					n.log.Warnf("%s pong nonce mismatch, expected %v, got %v\n", a, n.pingNonce, m.Nonce)
-				}
 
-			case *wire.MsgAddr:
-				n.log.Infof("%s MsgAddr received\n", a)
-				n.log.Debugf("%s got %d addresses\n", a, len(m.AddrList))
-				batch := make([]string, len(m.AddrList))
-				for i, a := range m.AddrList {
-					batch[i] = fmt.Sprintf("[%s]:%d", a.IP.String(), a.Port)
-				}
-				n.newAddrCh <- batch
-				n.Disconnect()
-
-			case *wire.MsgAddrV2:
-				n.log.Infof("%s MsgAddrV2 received\n", a)
-				n.log.Debugf("%s got %d addresses\n", a, len(m.AddrList))
-				batch := make([]string, len(m.AddrList))
-				for i, a := range m.AddrList {
-					batch[i] = a.Addr.String()
-				}
-				n.newAddrCh <- batch
-				n.Disconnect()
+		case *wire.MsgAddr:
+			n.log.Infof("%s MsgAddr received\n", a)
+			n.log.Debugf("%s got %d addresses\n", a, len(m.AddrList))
+			batch := make([]string, len(m.AddrList))
+			hosts := make([]string, len(m.AddrList))
+			for i, a := range m.AddrList {
+				hosts[i] = a.IP.String()
+				batch[i] = fmt.Sprintf("[%s]:%d", hosts[i], a.Port)
+			}
+			n.newAddrCh <- batch
+			n.addAddrs(hosts)
 
-			case *wire.MsgInv:
-				n.log.Infof("%s MsgInv received\n", a)
-				n.log.Debugf("%s data: %d\n", a, len(m.InvList))
-				// TODO: answer on inv
+		case *wire.MsgAddrV2:
+			n.log.Infof("%s MsgAddrV2 received\n", a)
+			n.log.Debugf("%s got %d addresses\n", a, len(m.AddrList))
+			batch := make([]string, len(m.AddrList))
+			hosts := make([]string, len(m.AddrList))
+			for i, a := range m.AddrList {
+				hosts[i] = a.Addr.String()
+				batch[i] = fmt.Sprintf("[%s]:%d", hosts[i], a.Port)
+			}
+			n.newAddrCh <- batch
+			n.addAddrs(hosts)
 
-			case *wire.MsgFeeFilter:
-				n.log.Infof("%s MsgFeeFilter received\n", a)
-				n.log.Debugf("%s fee: %v\n", a, m.MinFee)
+		case *wire.MsgInv:
+			n.log.Infof("%s MsgInv received\n", a)
+			n.log.Debugf("%s data: %d\n", a, len(m.InvList))
+			if n.observer != nil {
+				n.observer.Inv(n.EndpointSafe(), received, m.InvList)
+			}
+
+		case *wire.MsgFeeFilter:
+			n.log.Infof("%s MsgFeeFilter received\n", a)
+			n.log.Debugf("%s fee: %v\n", a, m.MinFee)
+			n.addFeeFilter(received, m.MinFee)
+
+		case *wire.MsgSendHeaders:
+			n.log.Infof("%s MsgSendHeaders received\n", a)
+			n.updateFeatures(func(f *Features) { f.SendHeaders = true })
+
+		case *wire.MsgSendAddrV2:
+			n.log.Infof("%s MsgSendAddrV2 received\n", a)
+			n.updateFeatures(func(f *Features) { f.SendAddrV2 = true })
+
+		case *cmd.MsgWtxidRelay:
+			n.log.Infof("%s MsgWtxidRelay received\n", a)
+			n.updateFeatures(func(f *Features) { f.WtxidRelay = true })
+
+		case *cmd.MsgSendCmpct:
+			n.log.Infof("%s MsgSendCmpct received\n", a)
+			n.log.Debugf("%s version: %d, announce: %v\n", a, m.Version, m.Announce)
+			n.updateFeatures(func(f *Features) { f.addCmpct(CmpctVersion{Version: m.Version, Announce: m.Announce}) })
+
+		case *wire.MsgHeaders:
+			n.log.Infof("%s MsgHeaders received\n", a)
+			n.log.Debugf("%s headers: %d\n", a, len(m.Headers))
+			// a few headers after the sync are new block announcements, BIP 130
+			if n.observer != nil && n.isObserving() && len(m.Headers) <= maxAnnouncedHeaders {
+				for _, h := range m.Headers {
+					n.observer.Block(n.EndpointSafe(), received, h.BlockHash(), observe.ViaHeaders)
+				}
+			}
+			// answer on our getheaders, announcements are dropped while busy
+			select {
+			case n.headersCh <- m.Headers:
+			default:
+				n.log.Debugf("%s headers not expected, dropping\n", a)
+			}
 
-			case *wire.MsgGetHeaders:
-				n.log.Infof("%s MsgGetHeaders received\n", a)
-				n.log.Debugf("%s headers: %d\n", a, len(m.BlockLocatorHashes))
+		case *wire.MsgBlock:
+			n.log.Infof("%s MsgBlock received\n", a)
+			n.log.Debugf("%s block: %s, %d txs\n", a, m.BlockHash(), len(m.Transactions))
+			select {
+			case n.blockCh <- &blockReply{block: m, raw: rawPayload}:
+			default:
+				n.log.Debugf("%s block not expected, dropping\n", a)
+			}
 
+		case *wire.MsgNotFound:
+			n.log.Infof("%s MsgNotFound received\n", a)
+			n.log.Debugf("%s items: %d\n", a, len(m.InvList))
+			select {
+			case n.blockCh <- &blockReply{notFound: m.InvList}:
 			default:
-				n.log.Infof("%s (%T) message received (unhandled)\n", a, m)
-				n.log.Debugf("%s msg: %+v\n", a, m)
 			}
+
+		case *cmd.MsgCmpctBlock:
+			hash := m.Header.BlockHash()
+			n.log.Infof("%s MsgCmpctBlock received\n", a)
+			n.log.Debugf("%s block: %s\n", a, hash)
+			if n.observer != nil {
+				n.observer.Block(n.EndpointSafe(), received, hash, observe.ViaCmpct)
+			}
+
+		case *cmd.MsgUnknown:
+			n.log.Warnf("%s ERR: unknown message %q, ignoring\n", a, m.Cmd)
+			n.updateFeatures(func(f *Features) { f.addUnknown(m.Cmd) })
+
+		case *wire.MsgGetHeaders:
+			n.log.Infof("%s MsgGetHeaders received\n", a)
+			n.log.Debugf("%s headers: %d\n", a, len(m.BlockLocatorHashes))
+
+		default:
+			n.log.Infof("%s (%T) message received (unhandled)\n", a, m)
+			n.log.Debugf("%s msg: %+v\n", a, m)
 		}
 	}
 }
@@ -7,14 +7,21 @@ import (
 	"math"
 	"math/big"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/1F47E/go-btc-xray/internal/blocks"
 	"github.com/1F47E/go-btc-xray/internal/cmd"
 	"github.com/1F47E/go-btc-xray/internal/config"
+	"github.com/1F47E/go-btc-xray/internal/fees"
+	"github.com/1F47E/go-btc-xray/internal/geoip"
+	"github.com/1F47E/go-btc-xray/internal/headers"
 	"github.com/1F47E/go-btc-xray/internal/logger"
-)
+	"github.com/1F47E/go-btc-xray/internal/observe"
 
-var cfg = config.New()
+	"github.com/btcsuite/btcd/wire"
+)
 
 type status int
 
@@ -32,34 +39,158 @@ type Result struct {
 }
 
 type Node struct {
-	log       *logger.Logger
-	ip        string
-	conn      net.Conn
+	cfg  *config.Config
+	log  *logger.Logger
+	ip   string
+	port uint16
+	// written by Connect under stateMu, other goroutines read it under the lock
+	conn      cmd.Transport
 	pingNonce uint64
 	pongCount uint8
+	// negotiated protocol version, min of ours and theirs, atomic
+	pver uint32
+	// signaled by the listener when the version message is received
+	versionCh chan struct{}
+	newAddrCh chan []string
+
+	// connection state and the version fields, written by Connect and
+	// the listener, read by the client workers
+	stateMu   sync.RWMutex
 	status    status
 	version   int32
-	newAddrCh chan []string
+	services  wire.ServiceFlag
+	userAgent string
+	height    int32
+	relay     bool
+	geo       geoip.Info
+	// tcp connection was established at least once
+	reachable bool
+	// last time the node answered with a version message
+	lastSeen time.Time
+	// node was added to the good nodes
+	good bool
+	// bootstrap sources (dns seeds, seed files) that returned this node
+	seeds []string
+	// record of the last connection that sent the results
+	saved *Record
+	// closed by the listener on exit
+	listenDone chan struct{}
+	// getaddr was sent, atomic
+	getaddrSent int32
+
+	// addr harvest, stats over all the connections, the rest per connection
+	addrMu        sync.Mutex
+	addrStats     AddrStats
+	harvestDone   chan struct{}
+	harvestClosed bool
+	harvested     int
+	// getaddr answer received
+	responded bool
+
+	// header sync, nil chain disables it
+	chain     *headers.Chain
+	headersCh chan []*wire.BlockHeader
+	// best header the peer gave us, guarded by stateMu with the two below
+	bestHeader *headers.Header
+	// peer has no headers after the best one
+	headersComplete bool
+	// peer sent invalid headers
+	headersInvalid bool
+
+	// block download, nil store disables it
+	blocks  *blocks.Store
+	blockCh chan *blockReply
+	// guarded by stateMu
+	blockStats BlockStats
+	// historic blocks probe result, guarded by stateMu
+	prune PruneStatus
+
+	// inv announcements recorder, nil disables the observation
+	observer *observe.Observer
+	// headers sync is done and announcements are recorded, atomic
+	observing int32
+
+	// optional features the peer signaled, written by the listener
+	featMu   sync.Mutex
+	features Features
+	// feefilter values over all the connections, last maxFeeSamples
+	feeFilters []fees.Sample
+
+	// v1 or v2 of the last connection, guarded by stateMu
+	transport string
+	// called for every message of the connection, nil disables it
+	tracer cmd.Tracer
+	// best known chain height for the auto start height, nil uses the profile one
+	heightSource func() int32
+
+	// unix nano of the last ping sent and the last round trip, atomic
+	pingSent int64
+	pingRTT  int64
+}
+
+// Record is a snapshot of the node saved to the storage
+type Record struct {
+	Endpoint  string           `json:"endpoint"`
+	Version   int32            `json:"version,omitempty"`
+	UserAgent string           `json:"user_agent,omitempty"`
+	Services  wire.ServiceFlag `json:"services"`
+	Height    int32            `json:"height,omitempty"`
+	// best header from the header sync
+	BestHeight  int32          `json:"best_height,omitempty"`
+	BestHash    string         `json:"best_hash,omitempty"`
+	ChainStatus headers.Status `json:"chain_status,omitempty"`
+	// answers on the block requests
+	Blocks *BlockStats `json:"blocks,omitempty"`
+	// blocks the node really serves: archive, limited or lying
+	Prune PruneStatus `json:"prune,omitempty"`
+	// optional features signaled after the handshake
+	Features *Features `json:"features,omitempty"`
+	// v2 if the node accepted the BIP 324 encrypted transport
+	Transport string `json:"transport,omitempty"`
+	// transactions relay flag from version, nil without version
+	Relay *bool `json:"relay,omitempty"`
+	// received feefilter values with timestamps
+	FeeFilters []fees.Sample `json:"feefilters,omitempty"`
+	// addresses the node gave us
+	Addr *AddrStats `json:"addr,omitempty"`
+	// last ping round trip, ms
+	PingRTT float64 `json:"ping_ms,omitempty"`
+	geoip.Info
 }
 
-func NewNode(log *logger.Logger, ip string, newAddrCh chan []string) *Node {
+func NewNode(cfg *config.Config, log *logger.Logger, ip string, port uint16, newAddrCh chan []string, chain *headers.Chain, store *blocks.Store, observer *observe.Observer) *Node {
 	n := Node{
+		cfg:       cfg,
 		log:       log,
 		ip:        ip,
+		port:      port,
 		newAddrCh: newAddrCh,
+		chain:     chain,
+		blocks:    store,
+		observer:  observer,
 	}
 	n.UpdatePingNonce()
 	return &n
 }
 
+// Disconnect closes the connection, Connect exits on its own
 func (n *Node) Disconnect() bool {
-	if n.conn != nil {
-		n.conn.Close()
-		n.conn = nil
-		n.status = disconnected
-		return true
+	n.stateMu.Lock()
+	defer n.stateMu.Unlock()
+	if n.conn == nil {
+		return false
+	}
+	n.conn.Close()
+	n.status = disconnected
+	return true
+}
+
+// Wait blocks until the listener of the last connection exits,
+// Connect closes the connection on return so the listener follows
+func (n *Node) Wait() {
+	if n.listenDone != nil {
+		<-n.listenDone
 	}
-	return false
 }
 
 func (n *Node) UpdatePingNonce() {
@@ -67,108 +198,372 @@ func (n *Node) UpdatePingNonce() {
 	n.pingNonce = nonceBig.Uint64()
 }
 
+// SetTracer is called before Connect, fn gets every message of the connections
+func (n *Node) SetTracer(fn cmd.Tracer) {
+	n.tracer = fn
+}
+
+// SetHeightSource sets the provider of the advertised start height,
+// used when the version profile has StartHeightAuto
+func (n *Node) SetHeightSource(f func() int32) {
+	n.heightSource = f
+}
+
+// ping with the current nonce, the listener updates it on pong
+func (n *Node) ping() error {
+	atomic.StoreInt64(&n.pingSent, time.Now().UnixNano())
+	return cmd.SendPing(n.conn, n.Pver(), n.pingNonce)
+}
+
+// pong with the current nonce received
+func (n *Node) pong(received time.Time) {
+	if sent := atomic.LoadInt64(&n.pingSent); sent > 0 {
+		atomic.StoreInt64(&n.pingRTT, received.UnixNano()-sent)
+	}
+}
+
+// PingRTT is the last ping round trip, 0 if no pong was received
+func (n *Node) PingRTT() time.Duration {
+	return time.Duration(atomic.LoadInt64(&n.pingRTT))
+}
+
+func (n *Node) getStatus() status {
+	n.stateMu.RLock()
+	defer n.stateMu.RUnlock()
+	return n.status
+}
+
+func (n *Node) setStatus(s status) {
+	n.stateMu.Lock()
+	n.status = s
+	n.stateMu.Unlock()
+}
+
 func (n *Node) IsNew() bool {
-	return n.status == new
+	return n.getStatus() == new
 }
 
 func (n *Node) IsDead() bool {
-	return n.status == dead
+	return n.getStatus() == dead
 }
 
 func (n *Node) IsConnecting() bool {
-	return n.status == connecting
+	return n.getStatus() == connecting
 }
 func (n *Node) IsConnected() bool {
+	n.stateMu.RLock()
+	defer n.stateMu.RUnlock()
 	return n.status == connected && n.conn != nil
 }
 
+// IsReachable reports whether the tcp connection was ever established
+func (n *Node) IsReachable() bool {
+	n.stateMu.RLock()
+	defer n.stateMu.RUnlock()
+	return n.reachable
+}
+
+// setVersion stores the fields of the version message
+func (n *Node) setVersion(m *wire.MsgVersion, received time.Time) {
+	n.stateMu.Lock()
+	defer n.stateMu.Unlock()
+	n.version = m.ProtocolVersion
+	n.services = m.Services
+	n.userAgent = m.UserAgent
+	n.height = m.LastBlock
+	n.relay = !m.DisableRelayTx
+	n.lastSeen = received
+}
+
+// HasVersion reports whether the node answered with a version message
+func (n *Node) HasVersion() bool {
+	n.stateMu.RLock()
+	defer n.stateMu.RUnlock()
+	return n.version != 0
+}
+
+// Version is the protocol version from the version message, 0 without one
+func (n *Node) Version() int32 {
+	n.stateMu.RLock()
+	defer n.stateMu.RUnlock()
+	return n.version
+}
+
+// HasServices reports whether the node advertised all the services in version
+func (n *Node) HasServices(services wire.ServiceFlag) bool {
+	n.stateMu.RLock()
+	defer n.stateMu.RUnlock()
+	return n.version != 0 && n.services&services == services
+}
+
+// Height is the start height the node claimed in version
+func (n *Node) Height() int32 {
+	n.stateMu.RLock()
+	defer n.stateMu.RUnlock()
+	return n.height
+}
+
+func (n *Node) LastSeen() time.Time {
+	n.stateMu.RLock()
+	defer n.stateMu.RUnlock()
+	return n.lastSeen
+}
+
+func (n *Node) IsGood() bool {
+	n.stateMu.RLock()
+	defer n.stateMu.RUnlock()
+	return n.good
+}
+
+// MarkGood returns false if the node was already marked as good
+func (n *Node) MarkGood() bool {
+	n.stateMu.Lock()
+	defer n.stateMu.Unlock()
+	if n.good {
+		return false
+	}
+	n.good = true
+	return true
+}
+
+func (n *Node) Port() uint16 {
+	return n.port
+}
+
+func (n *Node) Services() wire.ServiceFlag {
+	n.stateMu.RLock()
+	defer n.stateMu.RUnlock()
+	return n.services
+}
+
+func (n *Node) AddSeed(seed string) {
+	n.stateMu.Lock()
+	defer n.stateMu.Unlock()
+	for _, s := range n.seeds {
+		if s == seed {
+			return
+		}
+	}
+	n.seeds = append(n.seeds, seed)
+}
+
+// Seeds returns a copy of the bootstrap sources of the node
+func (n *Node) Seeds() []string {
+	n.stateMu.RLock()
+	defer n.stateMu.RUnlock()
+	return append([]string(nil), n.seeds...)
+}
+
+func (n *Node) IP() net.IP {
+	return net.ParseIP(n.ip)
+}
+
+func (n *Node) SetGeo(info geoip.Info) {
+	n.stateMu.Lock()
+	n.geo = info
+	n.stateMu.Unlock()
+}
+
+func (n *Node) Geo() geoip.Info {
+	n.stateMu.RLock()
+	defer n.stateMu.RUnlock()
+	return n.geo
+}
+
+// Record is the snapshot saved to the storage. After the first results
+// it is the record of the last connection that sent them,
+// so a recheck in progress or a failed one does not change it.
+func (n *Node) Record() Record {
+	n.stateMu.RLock()
+	saved, geo := n.saved, n.geo
+	n.stateMu.RUnlock()
+	if saved == nil {
+		return n.record()
+	}
+	r := *saved
+	// geo is looked up after the results
+	r.Info = geo
+	return r
+}
+
+// saveRecord keeps the current record as the saved one
+func (n *Node) saveRecord() {
+	r := n.record()
+	n.stateMu.Lock()
+	n.saved = &r
+	n.stateMu.Unlock()
+}
+
+func (n *Node) record() Record {
+	n.stateMu.RLock()
+	r := Record{
+		Endpoint:  n.EndpointSafe(),
+		Version:   n.version,
+		UserAgent: n.userAgent,
+		Services:  n.services,
+		Height:    n.height,
+		Info:      n.geo,
+		Prune:     n.prune,
+		Transport: n.transport,
+	}
+	hasVersion, relay := n.version != 0, n.relay
+	stats, best := n.blockStats, n.bestHeader
+	status := n.chainStatus()
+	n.stateMu.RUnlock()
+	r.ChainStatus = status
+	if n.blocks != nil && stats != (BlockStats{}) {
+		r.Blocks = &stats
+	}
+	if f := n.Features(); !f.empty() {
+		r.Features = &f
+	}
+	if hasVersion {
+		r.Relay = &relay
+	}
+	r.FeeFilters = n.FeeFilters()
+	if a := n.AddrStats(); a.Messages > 0 {
+		r.Addr = &a
+	}
+	if rtt := n.PingRTT(); rtt > 0 {
+		r.PingRTT = float64(rtt.Microseconds()) / 1000
+	}
+	if best != nil {
+		r.BestHeight = best.Height
+		r.BestHash = best.Hash.String()
+	}
+	return r
+}
+
 func (n *Node) Endpoint() string {
-	return fmt.Sprintf("%s:%d", n.ip, cfg.NodesPort)
+	return fmt.Sprintf("%s:%d", n.ip, n.port)
 }
 
 // wrapper with brackets for ipv6 needed for net.Dial
 func (n *Node) EndpointSafe() string {
-	return fmt.Sprintf("[%s]:%d", n.ip, cfg.NodesPort)
+	return fmt.Sprintf("[%s]:%d", n.ip, n.port)
 }
 
 // returning error here will consider the node as dead
 func (n *Node) Connect(ctx context.Context, resCh chan *Node) error {
-	n.status = connecting
+	n.setStatus(connecting)
 	a := fmt.Sprintf("▶︎ %s", n.ip)
 	n.log.Debugf("%s connecting...\n", a)
+	// results were sent, the record is saved again on exit
+	sent := false
 	defer func() {
+		// unblocks the listener
+		n.stateMu.Lock()
+		if n.conn != nil {
+			n.conn.Close()
+		}
 		n.conn = nil
+		n.stateMu.Unlock()
+		if sent {
+			n.saveRecord()
+		}
 		n.log.Debugf("%s closed\n", a)
 	}()
-	conn, err := net.DialTimeout("tcp", n.EndpointSafe(), cfg.NodeTimeout)
+	conn, err := n.dial(a)
 	if err != nil {
-		n.status = dead
+		n.setStatus(dead)
 		return fmt.Errorf("%s failed to connect: %w", a, err)
 	}
-	n.log.Debugf("%s connected\n", a)
-	n.conn = conn
+	n.log.Debugf("%s connected, %s transport\n", a, conn.Name())
+	if n.tracer != nil {
+		conn = cmd.Trace(conn, n.tracer)
+	}
+	n.stateMu.Lock()
+	n.reachable = true
 	n.status = connected
+	n.transport = conn.Name()
+	n.conn = conn
+	n.stateMu.Unlock()
+	n.setPver(n.cfg.Pver)
+	n.versionCh = make(chan struct{}, 1)
+	n.headersCh = make(chan []*wire.BlockHeader, 1)
+	n.blockCh = make(chan *blockReply, 1)
+	n.listenDone = make(chan struct{})
+	n.updateFeatures(func(f *Features) { *f = Features{} })
+	atomic.StoreInt32(&n.getaddrSent, 0)
+	n.resetHarvest()
 	// handle answers
 	// exit on closed connection or context cancel
 	go n.listen(ctx)
 
 	// ===== NEGOTIATION
-	// TODO: make it in a separate negotiation function
-	// 1. sending version
-	n.log.Debugf("%s sending version...\n", a)
-	err = cmd.SendVersion(n.conn, n.pingNonce)
+	err = n.negotiate(a)
 	if err != nil {
-		return fmt.Errorf("%s failed to write version: %v", a, err)
+		return err
 	}
-	n.log.Debugf("%s OK\n", a)
 
-	// 2. send addr v2
-	n.log.Debugf("%s sending sendaddrv2...\n", a)
-	err = cmd.SendAddrV2(n.conn)
-	if err != nil {
-		return fmt.Errorf("%s failed to write sendaddrv2: %v", a, err)
+	// ===== HEADERS AND BLOCKS
+	// before the results so the saved record has the chain status
+	if n.chain != nil {
+		n.syncHeaders(ctx, a)
 	}
-	n.log.Debugf("%s OK\n", a)
-
-	// 3. send verAck
-	// TODO: read version first
-	time.Sleep(2 * time.Second)
-	n.log.Debugf("%s sending verack...\n", a)
-	err = cmd.SendVerAck(n.conn)
+	// full nodes should serve any block
+	if n.blocks != nil && n.HasServices(wire.SFNodeNetwork) {
+		n.fetchBlocks(ctx, a)
+	}
+	// ====== NEGOTIATION DONE
+	// round trip of the ping is measured while waiting below
+	n.log.Debugf("%s sending ping...\n", a)
+	err = n.ping()
 	if err != nil {
-		return fmt.Errorf("%s failed to write verack: %v", a, err)
+		n.log.Errorf("%s failed to write ping: %v", a, err)
+		return nil
 	}
-	n.log.Debugf("%s OK\n", a)
+	// feature messages come after our verack, give them time to arrive
+	// so the saved record has them
+	time.Sleep(1 * time.Second)
 
 	// send results but continue working,
 	// asking for peers and sending a few pings
+	n.saveRecord()
+	sent = true
 	resCh <- n
 
-	// ====== NEGOTIATION DONE
-	time.Sleep(1 * time.Second)
-
 	// ask for peers once
 	n.log.Debugf("%s sending getaddr...\n", a)
-	err = cmd.SendGetAddr(n.conn)
+	atomic.StoreInt32(&n.getaddrSent, 1)
+	err = cmd.SendGetAddr(n.conn, n.Pver())
 	if err != nil {
 		n.log.Errorf("%s failed to write getaddr: %v", a, err)
 		return nil
 	}
 	n.log.Debugf("%s OK\n", a)
 
+	// pruned nodes advertising NODE_NETWORK and honest limited ones,
+	// after the results and getaddr so a disconnect does not lose them
+	if n.cfg.PruneProbe {
+		n.probePruning(ctx, a)
+	}
+
+	// observation keeps the connection, announcements are recorded by the listener
+	if n.observer != nil {
+		return n.observe(ctx, a)
+	}
+
+	// Harvest the addresses: stay connected for the addr window
+	// or until the harvest policy is satisfied, see addAddrs.
 	// Sending a ping to keep a connection while waiting for peers from get addr command
 	// Waiting for the pong in the listen goroutine and increment ping count
 	// Every ping should have a nonce different from the previous one
-	// Disconnect if ping count reached or no pong received
-	timeout, cancel := context.WithTimeout(ctx, cfg.PingTimeout)
+	timeout, cancel := context.WithTimeout(ctx, n.cfg.AddrWindow)
 	defer cancel()
-	ticker := time.NewTicker(1 * time.Minute)
+	ticker := time.NewTicker(n.cfg.PingInterval)
 	defer ticker.Stop()
 	pingCount := 0
 	for {
 		select {
+		case <-n.harvestDone:
+			n.log.Debugf("%s addresses harvested\n", a)
+			return nil
+		case <-n.listenDone:
+			n.log.Debugf("%s disconnected\n", a)
+			return nil
 		case <-timeout.Done():
-			n.log.Warnf("%s ping timeout\n", a)
+			n.log.Debugf("%s addr window passed\n", a)
 			return nil
 		case <-ctx.Done():
 			n.log.Warnf("%s context done, disconnecting\n", a)
@@ -178,16 +573,12 @@ func (n *Node) Connect(ctx context.Context, resCh chan *Node) error {
 				n.log.Debugf("%s disconnected\n", a)
 				return nil
 			}
-			if n.pongCount >= 1 {
-				n.log.Debugf("%s pong count reached\n", a)
-				return nil
-			}
-			if pingCount >= cfg.PingRetrys {
+			if pingCount >= n.cfg.PingRetrys {
 				n.log.Debugf("%s ping retry count reached\n", a)
 				return nil
 			}
 			n.log.Debugf("%s sending ping...\n", a)
-			err = cmd.SendPing(n.conn, n.pingNonce)
+			err = n.ping()
 			if err != nil {
 				n.log.Errorf("%s failed to write ping: %v", a, err)
 				return nil
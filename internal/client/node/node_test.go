@@ -0,0 +1,150 @@
+package node
+
+import (
+	"context"
+	"io"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1F47E/go-btc-xray/internal/blocks"
+	"github.com/1F47E/go-btc-xray/internal/config"
+	"github.com/1F47E/go-btc-xray/internal/headers"
+	"github.com/1F47E/go-btc-xray/internal/logger"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// peerConn answers getheaders with its headers and getdata with notfound,
+// straight to the channels the listener would use
+type peerConn struct {
+	n       *Node
+	headers []*wire.BlockHeader
+}
+
+func (c *peerConn) WriteMessage(msg wire.Message, pver uint32) error {
+	switch m := msg.(type) {
+	case *wire.MsgGetHeaders:
+		c.n.headersCh <- c.headers
+	case *wire.MsgGetData:
+		c.n.blockCh <- &blockReply{notFound: m.InvList}
+	}
+	return nil
+}
+
+func (c *peerConn) ReadMessage(pver uint32) (int, wire.Message, []byte, error) {
+	return 0, nil, nil, io.EOF
+}
+
+func (c *peerConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 18444}
+}
+
+func (c *peerConn) Close() error { return nil }
+
+func (c *peerConn) Name() string { return "v1" }
+
+// testNode is a connected regtest node with header sync and blocks enabled
+func testNode(t *testing.T) *Node {
+	t.Helper()
+	params := chaincfg.RegressionNetParams
+	missing := chainhash.Hash{1}
+	cfg := &config.Config{
+		Params:         &params,
+		HeadersTimeout: time.Second,
+		BlocksTimeout:  time.Second,
+		Blocks:         []config.BlockRef{{Hash: &missing}},
+	}
+	log := logger.New(cfg, nil)
+	log.SetOutput(io.Discard)
+	store, err := blocks.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to open the blocks store: %v", err)
+	}
+	chain := headers.New(&params, headers.Rules{NoRetarget: true})
+	n := NewNode(cfg, log, "203.0.113.7", 18444, nil, chain, store, nil)
+	n.conn = &peerConn{n: n}
+	n.setStatus(connected)
+	n.headersCh = make(chan []*wire.BlockHeader, 1)
+	n.blockCh = make(chan *blockReply, 1)
+	n.listenDone = make(chan struct{})
+	return n
+}
+
+// run with -race, Record is read by the saver while the node is connected
+func TestRecordDuringSync(t *testing.T) {
+	n := testNode(t)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				n.Record()
+				n.ChainStatus()
+			}
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		n.syncHeaders(ctx, "test")
+		n.fetchBlocks(ctx, "test")
+	}
+	close(done)
+	wg.Wait()
+
+	r := n.Record()
+	if r.Blocks == nil || r.Blocks.Missing != 200 {
+		t.Errorf("blocks %+v, want 200 missing", r.Blocks)
+	}
+	genesis := chaincfg.RegressionNetParams.GenesisHash
+	if r.BestHash != genesis.String() || r.ChainStatus == headers.StatusUnknown {
+		t.Errorf("best %d %s, status %s, want the genesis", r.BestHeight, r.BestHash, r.ChainStatus)
+	}
+}
+
+// a recheck resets the connection state, the saved record stays
+// the one of the last connection that sent the results
+func TestRecordRecheck(t *testing.T) {
+	n := testNode(t)
+	ctx := context.Background()
+	n.setVersion(&wire.MsgVersion{ProtocolVersion: 70016, Services: wire.SFNodeNetwork, UserAgent: "/test/"}, time.Now())
+	n.updateFeatures(func(f *Features) { f.SendHeaders = true })
+	n.syncHeaders(ctx, "test")
+	n.fetchBlocks(ctx, "test")
+	n.saveRecord()
+	want := n.Record()
+	if want.Features == nil || want.Blocks == nil || want.ChainStatus == headers.StatusUnknown {
+		t.Fatalf("record %+v misses the connection results", want)
+	}
+
+	// recheck: the features are reset and the peer sends a header with wrong bits
+	n.updateFeatures(func(f *Features) { *f = Features{} })
+	genesis := chaincfg.RegressionNetParams.GenesisBlock.Header
+	n.conn = &peerConn{n: n, headers: []*wire.BlockHeader{{
+		PrevBlock: genesis.BlockHash(),
+		Timestamp: genesis.Timestamp.Add(time.Minute),
+		Bits:      0x1d00ffff,
+	}}}
+	n.syncHeaders(ctx, "test")
+	n.fetchBlocks(ctx, "test")
+	if got := n.Record(); !reflect.DeepEqual(got, want) {
+		t.Errorf("record changed during the recheck:\n%+v\nwant\n%+v", got, want)
+	}
+
+	// the recheck sent its results
+	n.saveRecord()
+	got := n.Record()
+	if got.Features != nil || got.ChainStatus != headers.StatusInvalid || got.Blocks.Missing != 2 {
+		t.Errorf("record %+v, want the rechecked one", got)
+	}
+}
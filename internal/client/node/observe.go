@@ -0,0 +1,48 @@
+package node
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// headers messages up to this size are block announcements, as in bitcoin core
+const maxAnnouncedHeaders = 8
+
+func (n *Node) isObserving() bool {
+	return atomic.LoadInt32(&n.observing) == 1
+}
+
+// observe keeps the connection for n.cfg.ObserveDuration or until the peer leaves,
+// announcements are recorded by the listener, pings keep the peer from dropping us
+func (n *Node) observe(ctx context.Context, a string) error {
+	n.log.Infof("%s observing announcements\n", a)
+	atomic.StoreInt32(&n.observing, 1)
+	defer atomic.StoreInt32(&n.observing, 0)
+	var deadline <-chan time.Time
+	if n.cfg.ObserveDuration > 0 {
+		timer := time.NewTimer(n.cfg.ObserveDuration)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	ticker := time.NewTicker(n.cfg.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-deadline:
+			n.log.Debugf("%s observation done\n", a)
+			return nil
+		case <-ctx.Done():
+			return nil
+		case <-n.listenDone:
+			n.log.Debugf("%s peer left\n", a)
+			return nil
+		case <-ticker.C:
+			err := n.ping()
+			if err != nil {
+				n.log.Errorf("%s failed to write ping: %v", a, err)
+				return nil
+			}
+		}
+	}
+}
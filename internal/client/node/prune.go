@@ -0,0 +1,111 @@
+package node
+
+import (
+	"context"
+
+	"github.com/1F47E/go-btc-xray/internal/cmd"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// PruneStatus is what blocks the peer really serves compared to its services
+type PruneStatus string
+
+const (
+	PruneUnknown PruneStatus = ""
+	// serves historic blocks
+	PruneArchive PruneStatus = "archive"
+	// serves only recent blocks, as NODE_NETWORK_LIMITED promises
+	PruneLimited PruneStatus = "limited"
+	// does not serve the blocks its services promise
+	PruneLying PruneStatus = "lying"
+)
+
+// recent blocks NODE_NETWORK_LIMITED peers keep, BIP 159
+const limitedBlocks = 288
+
+func (n *Node) Prune() PruneStatus {
+	n.stateMu.RLock()
+	defer n.stateMu.RUnlock()
+	return n.prune
+}
+
+func (n *Node) setPrune(p PruneStatus) {
+	n.stateMu.Lock()
+	n.prune = p
+	n.stateMu.Unlock()
+}
+
+// probeBlocks returns a deep historic block and a recent one,
+// recent is known only with the header sync
+func (n *Node) probeBlocks() (deep, recent *chainhash.Hash) {
+	if len(n.cfg.Params.Checkpoints) > 0 {
+		deep = n.cfg.Params.Checkpoints[0].Hash
+	}
+	if n.chain == nil {
+		return deep, nil
+	}
+	tip := n.chain.Height()
+	if deep == nil && tip > limitedBlocks {
+		if hash, ok := n.chain.HashAt(1); ok {
+			deep = &hash
+		}
+	}
+	if tip > limitedBlocks {
+		if hash, ok := n.chain.HashAt(tip - 6); ok {
+			recent = &hash
+		}
+	}
+	return deep, recent
+}
+
+// probePruning checks the peer serves the blocks it advertises.
+// Limited peers disconnect on requests below their window,
+// they are asked only for the recent block.
+// Closed connection leaves the status unknown.
+func (n *Node) probePruning(ctx context.Context, a string) {
+	n.setPrune(PruneUnknown)
+	services := n.Services()
+	full := services&wire.SFNodeNetwork != 0
+	limited := services&cmd.SFNodeNetworkLimited != 0
+	if !full && !limited {
+		return
+	}
+	deep, recent := n.probeBlocks()
+	if recent != nil {
+		answer, _ := n.getBlock(ctx, a, recent)
+		switch {
+		case answer == blockClosed:
+			n.log.Debugf("%s prune probe: disconnected\n", a)
+			return
+		case answer != blockServed:
+			n.setPrune(PruneLying)
+			n.log.Infof("%s prune probe: %s\n", a, PruneLying)
+			return
+		case !full:
+			n.setPrune(PruneLimited)
+			n.log.Infof("%s prune probe: %s\n", a, PruneLimited)
+			return
+		}
+	}
+	if !full {
+		n.log.Debugf("%s no recent block to probe\n", a)
+		return
+	}
+	if deep == nil {
+		n.log.Debugf("%s no deep block to probe\n", a)
+		return
+	}
+	answer, _ := n.getBlock(ctx, a, deep)
+	switch answer {
+	case blockClosed:
+		n.log.Debugf("%s prune probe: disconnected\n", a)
+		return
+	case blockServed:
+		n.setPrune(PruneArchive)
+	default:
+		n.setPrune(PruneLying)
+	}
+	n.log.Infof("%s prune probe: %s\n", a, n.Prune())
+}
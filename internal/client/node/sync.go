@@ -0,0 +1,132 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/1F47E/go-btc-xray/internal/cmd"
+	"github.com/1F47E/go-btc-xray/internal/headers"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func (n *Node) askedAddr() bool {
+	return atomic.LoadInt32(&n.getaddrSent) == 1
+}
+
+// BestHeader is the best header the peer gave us, nil if unknown
+func (n *Node) BestHeader() *headers.Header {
+	n.stateMu.RLock()
+	defer n.stateMu.RUnlock()
+	return n.bestHeader
+}
+
+// ChainStatus compares the peer best header with our best chain
+func (n *Node) ChainStatus() headers.Status {
+	n.stateMu.RLock()
+	defer n.stateMu.RUnlock()
+	return n.chainStatus()
+}
+
+// chainStatus is called with stateMu held
+func (n *Node) chainStatus() headers.Status {
+	if n.headersInvalid {
+		return headers.StatusInvalid
+	}
+	if n.chain == nil || n.bestHeader == nil {
+		return headers.StatusUnknown
+	}
+	return n.chain.Classify(*n.bestHeader, n.headersComplete, n.height, n.cfg.HeaderLag)
+}
+
+// setBestHeader stores the best header the peer gave us,
+// complete if the peer has no headers after it
+func (n *Node) setBestHeader(h *headers.Header, complete bool) {
+	n.stateMu.Lock()
+	n.bestHeader = h
+	n.headersComplete = complete
+	n.stateMu.Unlock()
+}
+
+// syncHeaders asks the peer for headers until it has no more.
+// Every next batch starts from the last header the peer gave us,
+// so peers on a side branch are followed as well.
+// Only the peer holding the sync lease goes on after a full batch,
+// others stop after the first one to not download the same chain many times.
+func (n *Node) syncHeaders(ctx context.Context, a string) {
+	defer n.chain.DoneSync(n.Endpoint())
+	n.stateMu.Lock()
+	n.headersComplete = false
+	n.headersInvalid = false
+	n.stateMu.Unlock()
+	var from *chainhash.Hash
+	for {
+		locator := n.chain.Locator(from)
+		n.log.Debugf("%s sending getheaders from %s...\n", a, locator[0])
+		err := cmd.SendGetHeaders(n.conn, n.Pver(), locator)
+		if err != nil {
+			n.log.Errorf("%s failed to write getheaders: %v", a, err)
+			return
+		}
+		var hdrs []*wire.BlockHeader
+		select {
+		case hdrs = <-n.headersCh:
+		case <-n.listenDone:
+			return
+		case <-ctx.Done():
+			return
+		case <-time.After(n.cfg.HeadersTimeout):
+			n.log.Warnf("%s headers timeout\n", a)
+			return
+		}
+		// nothing after the locator, the peer best header is one of them
+		if len(hdrs) == 0 {
+			best := n.locatorBest(locator)
+			n.setBestHeader(best, best != nil)
+			return
+		}
+		res, err := n.chain.Connect(hdrs)
+		// the peer has no more headers after a short batch
+		complete := err == nil && len(hdrs) < headers.MaxHeaders
+		if res.Added+res.Known > 0 {
+			best := res.Best
+			n.setBestHeader(&best, complete)
+		}
+		if err != nil {
+			if errors.Is(err, headers.ErrInvalid) {
+				n.stateMu.Lock()
+				n.headersInvalid = true
+				n.stateMu.Unlock()
+			}
+			n.log.Warnf("%s headers rejected: %v\n", a, err)
+			return
+		}
+		if res.Reorg {
+			n.log.Infof("%s switched to a heavier branch, tip %d %s\n", a, res.Best.Height, res.Best.Hash)
+		}
+		n.log.Debugf("%s headers: %d added, %d known, best %d\n", a, res.Added, res.Known, res.Best.Height)
+		if complete {
+			return
+		}
+		// the peer has more headers
+		if !n.chain.TrySync(n.Endpoint()) {
+			return
+		}
+		from = &res.Best.Hash
+	}
+}
+
+// locatorBest guesses the peer best header after an empty headers answer:
+// the peer knows the first locator header at or below its claimed height
+func (n *Node) locatorBest(locator []*chainhash.Hash) *headers.Header {
+	for _, hash := range locator {
+		h, ok := n.chain.Lookup(*hash)
+		if ok && h.Height <= n.Height() {
+			return &h
+		}
+	}
+	return nil
+}
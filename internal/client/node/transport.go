@@ -0,0 +1,38 @@
+package node
+
+import (
+	"net"
+
+	"github.com/1F47E/go-btc-xray/internal/cmd"
+)
+
+// dial connects with the v2 transport first if enabled,
+// a peer refusing it is dialed again with v1
+func (n *Node) dial(a string) (cmd.Transport, error) {
+	conn, err := net.DialTimeout("tcp", n.EndpointSafe(), n.cfg.NodeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	// known node without the v2 service bit, do not waste a connection
+	if !n.cfg.V2Transport || (n.HasVersion() && !n.HasServices(cmd.SFNodeP2PV2)) {
+		return cmd.NewV1(conn, n.cfg.Btcnet), nil
+	}
+	t, err := cmd.NewV2(conn, n.cfg.Btcnet, n.cfg.NodeTimeout)
+	if err == nil {
+		return t, nil
+	}
+	conn.Close()
+	n.log.Debugf("%s v2 handshake failed, reconnecting with v1: %v\n", a, err)
+	conn, err = net.DialTimeout("tcp", n.EndpointSafe(), n.cfg.NodeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return cmd.NewV1(conn, n.cfg.Btcnet), nil
+}
+
+// Transport is v1 or v2 of the last connection, empty if never connected
+func (n *Node) Transport() string {
+	n.stateMu.RLock()
+	defer n.stateMu.RUnlock()
+	return n.transport
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"sort"
+	"strings"
+)
+
+// bootstrap sources that are not dns seeds, other tags are seed domains
+const (
+	// compiled-in or chain file fixed seeds
+	SeedFixed = "fixed"
+	// seed files, file:<name>
+	SeedFilePrefix = "file:"
+)
+
+// isDNSSeed reports whether the tag is a dns seed asked with the services filter
+func isDNSSeed(tag string) bool {
+	return tag != SeedFixed && !strings.HasPrefix(tag, SeedFilePrefix)
+}
+
+// SeedStats is a quality report of one bootstrap source
+type SeedStats struct {
+	Seed string `json:"seed"`
+	// nodes returned by the seed
+	Nodes int `json:"nodes"`
+	// tcp connection established
+	Reachable int `json:"reachable"`
+	// answered with a version message of our network
+	Protocol int `json:"protocol"`
+	// not tried yet
+	Pending int `json:"pending"`
+	// advertised the services requested from the seed in version,
+	// only dns seeds with DNS_SERVICES filter
+	Services int `json:"services,omitempty"`
+	// answered but without the requested services
+	ServicesMismatch int `json:"services_mismatch,omitempty"`
+}
+
+// SeedReport shows how many nodes of every seed were reachable
+// and spoke the right protocol, unreliable or poisoned seeds stand out.
+func (c *Client) SeedReport() []SeedStats {
+	stats := make(map[string]*SeedStats)
+	c.mu.Lock()
+	for _, n := range c.nodes {
+		for _, seed := range n.Seeds() {
+			s, ok := stats[seed]
+			if !ok {
+				s = &SeedStats{Seed: seed}
+				stats[seed] = s
+			}
+			s.Nodes++
+			if n.IsNew() {
+				s.Pending++
+			}
+			if n.IsReachable() {
+				s.Reachable++
+			}
+			if !n.HasVersion() {
+				continue
+			}
+			s.Protocol++
+			// seed files and fixed seeds were not asked for the services
+			if c.cfg.DnsServices == 0 || !isDNSSeed(seed) {
+				continue
+			}
+			if n.HasServices(c.cfg.DnsServices) {
+				s.Services++
+			} else {
+				s.ServicesMismatch++
+			}
+		}
+	}
+	c.mu.Unlock()
+	ret := make([]SeedStats, 0, len(stats))
+	for _, s := range stats {
+		ret = append(ret, *s)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Seed < ret[j].Seed
+	})
+	return ret
+}
@@ -5,8 +5,8 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/1F47E/go-btc-xray/internal/geoip"
 	"github.com/1F47E/go-btc-xray/internal/gui"
-	"github.com/1F47E/go-btc-xray/internal/storage"
 )
 
 // listen for new nodes from the connected nodes
@@ -31,7 +31,9 @@ func (c *Client) wNodesFeeder() {
 		case <-c.ctx.Done():
 			return
 		default:
+			c.mu.Lock()
 			if len(c.nodesNew) == 0 {
+				c.mu.Unlock()
 				// do not overload the cpu by spinning to fast
 				time.Sleep(time.Millisecond * 100)
 				continue
@@ -39,8 +41,9 @@ func (c *Client) wNodesFeeder() {
 			n := c.nodesNew[0]
 			// feed the first node from the new nodes
 			// pop it from the new slice for garbage collection
-			// will block if queue is full
 			c.nodesNew = c.nodesNew[1:]
+			c.mu.Unlock()
+			// will block if queue is full
 			c.queueCh <- n
 		}
 	}
@@ -55,7 +58,16 @@ func (c *Client) wNodeResultsHandler() {
 		case <-c.ctx.Done():
 			return
 		case n := <-c.nodeResCh:
+			// rechecked nodes are good already
+			if !n.MarkGood() {
+				continue
+			}
+			if c.geo != nil {
+				n.SetGeo(c.geo.Lookup(n.IP()))
+			}
+			c.mu.Lock()
 			c.nodesGood = append(c.nodesGood, n)
+			c.mu.Unlock()
 		}
 	}
 }
@@ -65,6 +77,7 @@ func (c *Client) wNodeSaver() {
 	c.log.Debug("[CLIENT]: SAVER worker started")
 	ticker := time.NewTicker(time.Second * 1)
 	cnt := 0
+	var dead int32
 	defer func() {
 		c.log.Debug("[CLIENT]: SAVER worker exited")
 		ticker.Stop()
@@ -74,17 +87,138 @@ func (c *Client) wNodeSaver() {
 		case <-c.ctx.Done():
 			return
 		case <-ticker.C:
-			if len(c.nodesGood) == cnt {
+			d := atomic.LoadInt32(&c.nodesDeadCnt)
+			// snapshot, the results handler appends to the good nodes
+			good := c.GoodNodes()
+			if len(good) == cnt && d == dead {
+				continue
+			}
+			// seeds quality depends on the dead nodes as well
+			dead = d
+			err := c.storage.SaveReport("seeds", c.SeedReport())
+			if err != nil {
+				c.log.Errorf("[CLIENT]: STAT: failed to save seeds report: %v\n", err)
+			}
+			if len(good) == cnt {
 				continue
 			}
 			// save good nodes to a file
-			err := storage.Save(c.nodesGood)
+			err = c.storage.Save(good)
 			if err != nil {
 				c.log.Errorf("[CLIENT]: STAT: failed to save nodes: %v\n", err)
 				continue
 			}
-			c.log.Infof("[CLIENT]: saved %d nodes", len(c.nodesGood))
-			cnt = len(c.nodesGood)
+			c.log.Infof("[CLIENT]: saved %d nodes", len(good))
+			cnt = len(good)
+
+			// optional features signaled by the good nodes
+			err = c.storage.SaveReport("features", c.FeaturesReport())
+			if err != nil {
+				c.log.Errorf("[CLIENT]: STAT: failed to save features report: %v\n", err)
+			}
+
+			// addresses given by every good node
+			err = c.storage.SaveReport("addr", c.AddrReport())
+			if err != nil {
+				c.log.Errorf("[CLIENT]: STAT: failed to save addr report: %v\n", err)
+			}
+
+			// feefilter distribution and relay flags, history is appended
+			feesReport := c.FeesReport()
+			err = c.storage.SaveReport("fees", feesReport)
+			if err != nil {
+				c.log.Errorf("[CLIENT]: STAT: failed to save fees report: %v\n", err)
+			}
+			err = c.storage.AppendReport("fees_history", feesReport)
+			if err != nil {
+				c.log.Errorf("[CLIENT]: STAT: failed to save fees history: %v\n", err)
+			}
+
+			// header chain tip and flagged nodes
+			if c.chain != nil {
+				err = c.storage.SaveReport("chain", c.ChainReport())
+				if err != nil {
+					c.log.Errorf("[CLIENT]: STAT: failed to save chain report: %v\n", err)
+				}
+			}
+
+			// full nodes not serving the requested blocks
+			if c.blocks != nil {
+				err = c.storage.SaveReport("blocks", c.BlocksReport())
+				if err != nil {
+					c.log.Errorf("[CLIENT]: STAT: failed to save blocks report: %v\n", err)
+				}
+			}
+
+			// countries and ASNs of the good nodes
+			if c.geo != nil {
+				infos := make([]geoip.Info, cnt)
+				for i, n := range good {
+					infos[i] = n.Geo()
+				}
+				err = c.storage.SaveReport("geo", geoip.Summarize(infos))
+				if err != nil {
+					c.log.Errorf("[CLIENT]: STAT: failed to save geo report: %v\n", err)
+				}
+			}
+		}
+	}
+}
+
+// save the propagation report of the observed announcements
+func (c *Client) wObserveSaver() {
+	c.log.Debug("[CLIENT]: OBSERVE worker started")
+	ticker := time.NewTicker(time.Second * 10)
+	defer func() {
+		c.log.Debug("[CLIENT]: OBSERVE worker exited")
+		ticker.Stop()
+	}()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			err := c.observer.Flush()
+			if err != nil {
+				c.log.Errorf("[CLIENT]: OBSERVE: failed to write events: %v\n", err)
+			}
+			err = c.storage.SaveReport("propagation", c.observer.Report())
+			if err != nil {
+				c.log.Errorf("[CLIENT]: OBSERVE: failed to save propagation report: %v\n", err)
+			}
+			err = c.storage.SaveReport("blockrace", c.observer.RaceReport())
+			if err != nil {
+				c.log.Errorf("[CLIENT]: OBSERVE: failed to save block race report: %v\n", err)
+			}
+		}
+	}
+}
+
+// put good nodes verified too long ago back to the queue
+func (c *Client) wNodesRechecker() {
+	c.log.Debug("[CLIENT]: RECHECK worker started")
+	ticker := time.NewTicker(c.recheck)
+	defer func() {
+		c.log.Debug("[CLIENT]: RECHECK worker exited")
+		ticker.Stop()
+	}()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			cnt := 0
+			deadline := time.Now().Add(-c.recheck)
+			c.mu.Lock()
+			for _, n := range c.nodesGood {
+				if n.IsConnecting() || n.IsConnected() || n.LastSeen().After(deadline) {
+					continue
+				}
+				c.nodesNew = append(c.nodesNew, n)
+				cnt++
+			}
+			c.mu.Unlock()
+			c.log.Debugf("[CLIENT]: RECHECK: %d good nodes queued", cnt)
 		}
 	}
 }
@@ -103,9 +237,9 @@ func (c *Client) wNodesConnector(n int) {
 		case n := <-c.queueCh:
 			atomic.AddInt32(&c.activeConns, 1)
 			err := n.Connect(c.ctx, c.nodeResCh)
-			if err != nil {
+			// failed recheck of a good node is not a new dead node
+			if err != nil && !n.IsGood() {
 				atomic.AddInt32(&c.nodesDeadCnt, 1)
-
 			}
 			atomic.AddInt32(&c.activeConns, -1)
 		}
@@ -128,14 +262,21 @@ func (c *Client) wGuiUpdater() {
 			// send new data to gui
 			connCnt := c.ActiveConns()
 			deadCnt := atomic.LoadInt32(&c.nodesDeadCnt)
-			c.guiCh <- gui.IncomingData{
+			c.mu.Lock()
+			data := gui.IncomingData{
 				Connections: connCnt,
 				NodesTotal:  len(c.nodes),
 				NodesQueued: len(c.nodesNew),
 				NodesGood:   len(c.nodesGood),
 				NodesDead:   deadCnt,
 			}
-			c.log.Debugf("[CLIENT]: STAT: total:%d, connected:%d/%d, good:%d, dead:%d", len(c.nodes), connCnt, cfg.ConnectionsLimit, len(c.nodesGood), c.nodesDeadCnt)
+			c.mu.Unlock()
+			// feefilter distribution of the good nodes
+			if c.cfg.Gui {
+				data.Fees = c.FeesReport().FeeFilter
+			}
+			c.guiCh <- data
+			c.log.Debugf("[CLIENT]: STAT: total:%d, connected:%d/%d, good:%d, dead:%d", data.NodesTotal, connCnt, c.cfg.ConnectionsLimit, data.NodesGood, deadCnt)
 
 			// report G count and memory used
 			var m runtime.MemStats
@@ -6,51 +6,110 @@ import (
 
 	"github.com/1F47E/go-btc-xray/internal/config"
 
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
 )
 
-var cfg = config.New()
-
-func SendVersion(conn net.Conn, nonce uint64) error {
-	msg := localVersionMsg(nonce)
-	return writeMessage(conn, msg)
+// SendVersion always uses our protocol version pver,
+// every other message is encoded with the negotiated one
+func SendVersion(t Transport, pver uint32, profile config.VersionProfile, nonce uint64, height int32) error {
+	if t == nil {
+		return fmt.Errorf("no connection")
+	}
+	msg := localVersionMsg(t.RemoteAddr(), pver, profile, nonce, height)
+	return writeMessage(t, msg, pver)
 }
 
-func SendAddrV2(conn net.Conn) error {
+func SendAddrV2(t Transport, pver uint32) error {
 	msg := wire.NewMsgSendAddrV2()
-	return writeMessage(conn, msg)
+	return writeMessage(t, msg, pver)
+}
+
+func SendWtxidRelay(t Transport, pver uint32) error {
+	return writeMessage(t, &MsgWtxidRelay{}, pver)
+}
+
+func SendVerAck(t Transport, pver uint32) error {
+	return writeMessage(t, wire.NewMsgVerAck(), pver)
+}
+
+func SendHeaders(t Transport, pver uint32) error {
+	return writeMessage(t, wire.NewMsgSendHeaders(), pver)
+}
+
+// SendFeeFilter asks the peer to not announce transactions below minFee sat/kvB
+func SendFeeFilter(t Transport, pver uint32, minFee int64) error {
+	return writeMessage(t, wire.NewMsgFeeFilter(minFee), pver)
 }
 
-func SendVerAck(conn net.Conn) error {
-	return writeMessage(conn, wire.NewMsgVerAck())
+// SendCmpct announces compact blocks support of the version,
+// announce asks the peer to push new blocks as cmpctblock
+func SendCmpct(t Transport, pver uint32, announce bool, version uint64) error {
+	return writeMessage(t, &MsgSendCmpct{Announce: announce, Version: version}, pver)
 }
 
-func SendGetAddr(conn net.Conn) error {
+func SendGetAddr(t Transport, pver uint32) error {
 	msg := wire.NewMsgGetAddr()
-	return writeMessage(conn, msg)
+	return writeMessage(t, msg, pver)
 }
 
-func SendPing(conn net.Conn, nonce uint64) error {
+// SendGetHeaders asks for up to 2000 headers after the first locator hash the peer knows
+func SendGetHeaders(t Transport, pver uint32, locator []*chainhash.Hash) error {
+	msg := wire.NewMsgGetHeaders()
+	msg.ProtocolVersion = pver
+	for _, hash := range locator {
+		err := msg.AddBlockLocatorHash(hash)
+		if err != nil {
+			return err
+		}
+	}
+	return writeMessage(t, msg, pver)
+}
+
+// SendGetData asks for the inventory items, blocks answer with block or notfound
+func SendGetData(t Transport, pver uint32, invs []*wire.InvVect) error {
+	msg := wire.NewMsgGetDataSizeHint(uint(len(invs)))
+	for _, inv := range invs {
+		err := msg.AddInvVect(inv)
+		if err != nil {
+			return err
+		}
+	}
+	return writeMessage(t, msg, pver)
+}
+
+func SendPing(t Transport, pver uint32, nonce uint64) error {
 	msg := wire.NewMsgPing(nonce)
-	return writeMessage(conn, msg)
+	return writeMessage(t, msg, pver)
 }
 
-func writeMessage(conn net.Conn, msg wire.Message) error {
-	if conn == nil {
+func SendPong(t Transport, pver uint32, nonce uint64) error {
+	return writeMessage(t, wire.NewMsgPong(nonce), pver)
+}
+
+func writeMessage(t Transport, msg wire.Message, pver uint32) error {
+	if t == nil {
 		return fmt.Errorf("no connection")
 	}
-	return wire.WriteMessage(conn, msg, cfg.Pver, cfg.Btcnet)
+	return t.WriteMessage(msg, pver)
 }
 
 // localVersionMsg creates a version message that can be used to send to the
-// remote peer.
-func localVersionMsg(nonce uint64) *wire.MsgVersion {
-	var blockNum int32
-	theirNA := wire.NetAddress{
+// remote peer. Fields come from the configured version profile,
+// height is the advertised start height.
+func localVersionMsg(remote net.Addr, pver uint32, profile config.VersionProfile, nonce uint64, height int32) *wire.MsgVersion {
+
+	// addr_recv, loopback unless the real peer address is requested
+	theirNA := &wire.NetAddress{
 		Services: wire.SFNodeNetwork,
 		IP:       net.ParseIP("::ffff:127.0.0.1"),
 		Port:     0,
 	}
+	if profile.AddrRecv {
+		if tcp, ok := remote.(*net.TCPAddr); ok {
+			theirNA = wire.NewNetAddress(tcp, 0)
+		}
+	}
 
 	// Older nodes previously added the IP and port information to the
 	// address manager which proved to be unreliable as an inbound
@@ -59,7 +118,7 @@ func localVersionMsg(nonce uint64) *wire.MsgVersion {
 	//
 	// Also, the timestamp is unused in the version message.
 	ourNA := &wire.NetAddress{
-		Services: wire.SFNodeNetwork,
+		Services: profile.Services,
 	}
 
 	// Generate a unique nonce for this peer so self connections can be
@@ -67,12 +126,12 @@ func localVersionMsg(nonce uint64) *wire.MsgVersion {
 	// recently seen nonces.
 
 	// Version message.
-	msg := wire.NewMsgVersion(ourNA, &theirNA, nonce, blockNum)
-	_ = msg.AddUserAgent("btcd", "0.23.3", "")
-	msg.Services = wire.SFNodeNetwork
-	msg.ProtocolVersion = int32(cfg.Pver)
+	msg := wire.NewMsgVersion(ourNA, theirNA, nonce, height)
+	msg.UserAgent = profile.UserAgent
+	msg.Services = profile.Services
+	msg.ProtocolVersion = int32(pver)
 	// Advertise if inv messages for transactions are desired.
-	// msg.DisableRelayTx = p.cfg.DisableRelayTx
+	msg.DisableRelayTx = !profile.Relay
 
 	return msg
 }
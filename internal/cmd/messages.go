@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// minimal protocol versions of the optional feature messages
+const (
+	SendHeadersVersion = wire.SendHeadersVersion // 70012, BIP 130
+	FeeFilterVersion   = wire.FeeFilterVersion   // 70013, BIP 133
+	AddrV2Version      = wire.AddrV2Version      // 70016, BIP 155
+	WtxidRelayVersion  = uint32(70016)           // BIP 339
+	SendCmpctVersion   = uint32(70014)           // BIP 152
+)
+
+// service bits btcd wire does not define
+const (
+	// serves only the last 288 blocks, BIP 159
+	SFNodeNetworkLimited wire.ServiceFlag = 1 << 10
+	// accepts the v2 encrypted transport, BIP 324
+	SFNodeP2PV2 wire.ServiceFlag = 1 << 11
+)
+
+// Negotiate returns the protocol version both sides understand
+func Negotiate(ours uint32, theirs int32) uint32 {
+	if theirs <= 0 {
+		return ours
+	}
+	if uint32(theirs) < ours {
+		return uint32(theirs)
+	}
+	return ours
+}
+
+// ===== messages btcd wire does not implement
+
+// MsgWtxidRelay announces wtxid based transaction relay, BIP 339.
+// Has no payload and must be sent between version and verack.
+type MsgWtxidRelay struct{}
+
+func (msg *MsgWtxidRelay) BtcDecode(r io.Reader, pver uint32, enc wire.MessageEncoding) error {
+	return nil
+}
+
+func (msg *MsgWtxidRelay) BtcEncode(w io.Writer, pver uint32, enc wire.MessageEncoding) error {
+	return nil
+}
+
+func (msg *MsgWtxidRelay) Command() string {
+	return "wtxidrelay"
+}
+
+func (msg *MsgWtxidRelay) MaxPayloadLength(pver uint32) uint32 {
+	return 0
+}
+
+// MsgSendCmpct announces compact block relay, BIP 152.
+// Announce asks the peer to send new blocks as cmpctblock right away.
+type MsgSendCmpct struct {
+	Announce bool
+	Version  uint64
+}
+
+func (msg *MsgSendCmpct) BtcDecode(r io.Reader, pver uint32, enc wire.MessageEncoding) error {
+	var buf [9]byte
+	_, err := io.ReadFull(r, buf[:])
+	if err != nil {
+		return err
+	}
+	msg.Announce = buf[0] != 0
+	msg.Version = binary.LittleEndian.Uint64(buf[1:])
+	return nil
+}
+
+func (msg *MsgSendCmpct) BtcEncode(w io.Writer, pver uint32, enc wire.MessageEncoding) error {
+	var buf [9]byte
+	if msg.Announce {
+		buf[0] = 1
+	}
+	binary.LittleEndian.PutUint64(buf[1:], msg.Version)
+	_, err := w.Write(buf[:])
+	return err
+}
+
+func (msg *MsgSendCmpct) Command() string {
+	return "sendcmpct"
+}
+
+func (msg *MsgSendCmpct) MaxPayloadLength(pver uint32) uint32 {
+	return 9
+}
+
+// MsgCmpctBlock is a compact block announcement, BIP 152.
+// Only the header is decoded, short ids and prefilled transactions are skipped.
+type MsgCmpctBlock struct {
+	Header wire.BlockHeader
+}
+
+func (msg *MsgCmpctBlock) BtcDecode(r io.Reader, pver uint32, enc wire.MessageEncoding) error {
+	err := msg.Header.Deserialize(r)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(io.Discard, r)
+	return err
+}
+
+func (msg *MsgCmpctBlock) BtcEncode(w io.Writer, pver uint32, enc wire.MessageEncoding) error {
+	return msg.Header.Serialize(w)
+}
+
+func (msg *MsgCmpctBlock) Command() string {
+	return "cmpctblock"
+}
+
+func (msg *MsgCmpctBlock) MaxPayloadLength(pver uint32) uint32 {
+	return wire.MaxBlockPayload
+}
+
+// MsgUnknown is a message neither btcd wire nor we implement,
+// the payload is kept as is
+type MsgUnknown struct {
+	Cmd     string
+	Payload []byte
+}
+
+func (msg *MsgUnknown) BtcDecode(r io.Reader, pver uint32, enc wire.MessageEncoding) error {
+	payload, err := io.ReadAll(r)
+	msg.Payload = payload
+	return err
+}
+
+func (msg *MsgUnknown) BtcEncode(w io.Writer, pver uint32, enc wire.MessageEncoding) error {
+	_, err := w.Write(msg.Payload)
+	return err
+}
+
+func (msg *MsgUnknown) Command() string {
+	return msg.Cmd
+}
+
+func (msg *MsgUnknown) MaxPayloadLength(pver uint32) uint32 {
+	return wire.MaxMessagePayload
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// magic, command, length, checksum
+const messageHeaderSize = 24
+
+// messages btcd wire does not implement, by command
+var extraMessages = map[string]func() wire.Message{
+	"wtxidrelay": func() wire.Message { return &MsgWtxidRelay{} },
+	"sendcmpct":  func() wire.Message { return &MsgSendCmpct{} },
+	"cmpctblock": func() wire.Message { return &MsgCmpctBlock{} },
+}
+
+// ReadMessage reads one message like wire.ReadMessageN, but commands
+// btcd does not know come as our types or *MsgUnknown instead of
+// wire.ErrUnknownMessage. Payload decode errors are *wire.MessageError with
+// the raw message as *MsgUnknown and the stream stays in sync,
+// any other error leaves the connection unusable.
+func ReadMessage(r io.Reader, pver uint32, btcnet wire.BitcoinNet) (int, wire.Message, []byte, error) {
+	var hdr [messageHeaderSize]byte
+	n, err := io.ReadFull(r, hdr[:])
+	if err != nil {
+		return n, nil, nil, err
+	}
+	magic := wire.BitcoinNet(binary.LittleEndian.Uint32(hdr[0:4]))
+	if magic != btcnet {
+		return n, nil, nil, fmt.Errorf("message from other network [%v]", magic)
+	}
+	length := binary.LittleEndian.Uint32(hdr[16:20])
+	if length > wire.MaxMessagePayload {
+		return n, nil, nil, fmt.Errorf("message payload is too large: %d bytes", length)
+	}
+	command := string(bytes.TrimRight(hdr[4:16], "\x00"))
+	payload := make([]byte, length)
+	read, err := io.ReadFull(r, payload)
+	n += read
+	if err != nil {
+		return n, nil, nil, err
+	}
+	if !bytes.Equal(chainhash.DoubleHashB(payload)[:4], hdr[20:24]) {
+		return n, &MsgUnknown{Cmd: command, Payload: payload}, payload, messageError(command, errors.New("payload checksum failed"))
+	}
+	msg, err := decodeMessage(hdr[:], command, payload, pver, btcnet)
+	return n, msg, payload, err
+}
+
+// decodeMessage makes the message from the checked payload,
+// hdr is the v1 header of it. Failed to decode comes as *MsgUnknown with the error
+func decodeMessage(hdr []byte, command string, payload []byte, pver uint32, btcnet wire.BitcoinNet) (wire.Message, error) {
+	if newMsg, ok := extraMessages[command]; ok {
+		msg := newMsg()
+		err := msg.BtcDecode(bytes.NewReader(payload), pver, wire.WitnessEncoding)
+		if err != nil {
+			return &MsgUnknown{Cmd: command, Payload: payload}, messageError(command, err)
+		}
+		return msg, nil
+	}
+
+	// the whole message is buffered, wire decodes it from memory.
+	// witness encoding, blocks and transactions may carry witness data
+	full := make([]byte, 0, messageHeaderSize+len(payload))
+	full = append(append(full, hdr...), payload...)
+	_, msg, _, err := wire.ReadMessageWithEncodingN(bytes.NewReader(full), pver, btcnet, wire.WitnessEncoding)
+	if err == wire.ErrUnknownMessage {
+		return &MsgUnknown{Cmd: command, Payload: payload}, nil
+	}
+	if err != nil {
+		return &MsgUnknown{Cmd: command, Payload: payload}, messageError(command, err)
+	}
+	return msg, nil
+}
+
+// frameHeader is the v1 header of the payload
+func frameHeader(command string, payload []byte, btcnet wire.BitcoinNet) []byte {
+	hdr := make([]byte, messageHeaderSize)
+	binary.LittleEndian.PutUint32(hdr[0:4], uint32(btcnet))
+	copy(hdr[4:16], command)
+	binary.LittleEndian.PutUint32(hdr[16:20], uint32(len(payload)))
+	copy(hdr[20:24], chainhash.DoubleHashB(payload)[:4])
+	return hdr
+}
+
+func messageError(command string, err error) error {
+	var msgErr *wire.MessageError
+	if errors.As(err, &msgErr) {
+		return msgErr
+	}
+	return &wire.MessageError{Func: "cmd.ReadMessage", Description: fmt.Sprintf("%s: %v", command, err)}
+}
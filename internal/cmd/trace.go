@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"bytes"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Tracer is called for every message sent or received on a traced
+// transport with the payload size, from the reading and the writing goroutines.
+// Received messages failed to decode come as *MsgUnknown with the error
+type Tracer func(sent bool, msg wire.Message, size int, err error)
+
+// traced calls the tracer before a message is written and after it is read
+type traced struct {
+	Transport
+	fn Tracer
+}
+
+func Trace(t Transport, fn Tracer) Transport {
+	return &traced{Transport: t, fn: fn}
+}
+
+func (t *traced) WriteMessage(msg wire.Message, pver uint32) error {
+	var buf bytes.Buffer
+	_ = msg.BtcEncode(&buf, pver, wire.BaseEncoding)
+	t.fn(true, msg, buf.Len(), nil)
+	return t.Transport.WriteMessage(msg, pver)
+}
+
+// ReadMessage skips errors without a message, the connection is unusable after them
+func (t *traced) ReadMessage(pver uint32) (int, wire.Message, []byte, error) {
+	cnt, msg, payload, err := t.Transport.ReadMessage(pver)
+	if msg != nil {
+		t.fn(false, msg, len(payload), err)
+	}
+	return cnt, msg, payload, err
+}
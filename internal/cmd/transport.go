@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"bytes"
+	"net"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Transport sends and receives messages on a peer connection,
+// v1 is the plaintext framing, v2 the BIP 324 encrypted one
+type Transport interface {
+	// WriteMessage is safe to call from several goroutines
+	WriteMessage(msg wire.Message, pver uint32) error
+	// ReadMessage works like the package ReadMessage,
+	// *wire.MessageError leaves the stream in sync
+	ReadMessage(pver uint32) (int, wire.Message, []byte, error)
+	RemoteAddr() net.Addr
+	Close() error
+	// "v1" or "v2"
+	Name() string
+}
+
+const (
+	TransportV1 = "v1"
+	TransportV2 = "v2"
+)
+
+// v1 is the plaintext transport with magic, command and checksum framing
+type v1 struct {
+	conn   net.Conn
+	btcnet wire.BitcoinNet
+}
+
+func NewV1(conn net.Conn, btcnet wire.BitcoinNet) Transport {
+	return &v1{conn: conn, btcnet: btcnet}
+}
+
+// WriteMessage encodes the whole message first, one Write is not
+// interleaved with messages written from other goroutines
+func (t *v1) WriteMessage(msg wire.Message, pver uint32) error {
+	var buf bytes.Buffer
+	err := wire.WriteMessage(&buf, msg, pver, t.btcnet)
+	if err != nil {
+		return err
+	}
+	_, err = t.conn.Write(buf.Bytes())
+	return err
+}
+
+func (t *v1) ReadMessage(pver uint32) (int, wire.Message, []byte, error) {
+	return ReadMessage(t.conn, pver, t.btcnet)
+}
+
+func (t *v1) RemoteAddr() net.Addr {
+	return t.conn.RemoteAddr()
+}
+
+func (t *v1) Close() error {
+	return t.conn.Close()
+}
+
+func (t *v1) Name() string {
+	return TransportV1
+}
@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/1F47E/go-btc-xray/internal/bip324"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ErrV2Refused is returned when the peer closed the connection or did not
+// answer before sending its key, most likely a v1 only node
+var ErrV2Refused = errors.New("v2 transport refused")
+
+// BIP 324 one byte message ids, other commands are sent in full
+var shortIDs = [...]string{
+	1: "addr", 2: "block", 3: "blocktxn", 4: "cmpctblock", 5: "feefilter",
+	6: "filteradd", 7: "filterclear", 8: "filterload", 9: "getblocks", 10: "getblocktxn",
+	11: "getdata", 12: "getheaders", 13: "headers", 14: "inv", 15: "mempool",
+	16: "merkleblock", 17: "notfound", 18: "ping", 19: "pong", 20: "sendcmpct",
+	21: "tx", 22: "getcfilters", 23: "cfilter", 24: "getcfheaders", 25: "cfheaders",
+	26: "getcfcheckpt", 27: "cfcheckpt", 28: "addrv2",
+}
+
+var shortIDByCommand = func() map[string]byte {
+	ret := make(map[string]byte, len(shortIDs))
+	for id, command := range shortIDs {
+		if command != "" {
+			ret[command] = byte(id)
+		}
+	}
+	return ret
+}()
+
+// zero byte and 12 bytes of the command before the payload
+const longCommandSize = 1 + wire.CommandSize
+
+// v2 is the BIP 324 encrypted transport
+type v2 struct {
+	conn   net.Conn
+	btcnet wire.BitcoinNet
+	// read only by the listener after the handshake
+	r *bufio.Reader
+	s *bip324.Session
+	// send cipher state changes with every packet
+	mu sync.Mutex
+}
+
+// NewV2 does the BIP 324 handshake as the initiator: our key and garbage,
+// their key, then the terminators and the version packets both ways,
+// all within the timeout
+func NewV2(conn net.Conn, btcnet wire.BitcoinNet, timeout time.Duration) (Transport, error) {
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	defer func() { _ = conn.SetDeadline(time.Time{}) }()
+
+	key, err := bip324.NewKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create v2 key: %v", err)
+	}
+	garbage, err := randomGarbage()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create v2 garbage: %v", err)
+	}
+	_, err = conn.Write(append(key.Public[:], garbage...))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrV2Refused, err)
+	}
+
+	// v1 nodes take our key for a message header with a wrong magic and disconnect
+	r := bufio.NewReader(conn)
+	var theirs [bip324.PubKeyLen]byte
+	_, err = io.ReadFull(r, theirs[:])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrV2Refused, err)
+	}
+	secret, err := key.ECDH(theirs, true)
+	if err != nil {
+		return nil, err
+	}
+	s, err := bip324.NewSession(secret, btcnet, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive v2 keys: %v", err)
+	}
+
+	// terminator and the empty version packet, it authenticates our garbage
+	out := make([]byte, 0, bip324.TerminatorLen+bip324.LengthLen+bip324.Overhead)
+	out = append(out, s.SendTerminator[:]...)
+	out = append(out, s.Encrypt(nil, garbage, false)...)
+	_, err = conn.Write(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write v2 version: %v", err)
+	}
+
+	received, err := readGarbage(r, s.RecvTerminator)
+	if err != nil {
+		return nil, err
+	}
+	t := &v2{conn: conn, btcnet: btcnet, r: r, s: s}
+	// their version packet, decoys before it are skipped
+	aad := received
+	for {
+		_, _, ignore, err := t.readPacket(aad)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read v2 version: %v", err)
+		}
+		aad = nil
+		if !ignore {
+			break
+		}
+	}
+	return t, nil
+}
+
+// randomGarbage of random length, makes the handshake size unpredictable
+func randomGarbage() ([]byte, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(bip324.MaxGarbageLen+1))
+	if err != nil {
+		return nil, err
+	}
+	garbage := make([]byte, n.Int64())
+	_, err = rand.Read(garbage)
+	return garbage, err
+}
+
+// readGarbage reads up to and including the terminator, returns the garbage
+func readGarbage(r *bufio.Reader, terminator [bip324.TerminatorLen]byte) ([]byte, error) {
+	buf := make([]byte, bip324.TerminatorLen, bip324.MaxGarbageLen+bip324.TerminatorLen)
+	_, err := io.ReadFull(r, buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read v2 garbage: %v", err)
+	}
+	for !bytes.Equal(buf[len(buf)-bip324.TerminatorLen:], terminator[:]) {
+		if len(buf) == cap(buf) {
+			return nil, fmt.Errorf("v2 garbage terminator not found")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read v2 garbage: %v", err)
+		}
+		buf = append(buf, b)
+	}
+	return buf[:len(buf)-bip324.TerminatorLen], nil
+}
+
+// readPacket returns the decrypted contents and the bytes read
+func (t *v2) readPacket(aad []byte) (int, []byte, bool, error) {
+	var length [bip324.LengthLen]byte
+	n, err := io.ReadFull(t.r, length[:])
+	if err != nil {
+		return n, nil, false, err
+	}
+	size := t.s.DecryptLength(length[:])
+	if size > longCommandSize+wire.MaxMessagePayload {
+		return n, nil, false, fmt.Errorf("v2 packet is too large: %d bytes", size)
+	}
+	packet := make([]byte, int(size)+bip324.Overhead)
+	read, err := io.ReadFull(t.r, packet)
+	n += read
+	if err != nil {
+		return n, nil, false, err
+	}
+	contents, ignore, err := t.s.Decrypt(packet, aad)
+	return n, contents, ignore, err
+}
+
+// ReadMessage skips decoy packets, authentication failures are fatal
+func (t *v2) ReadMessage(pver uint32) (int, wire.Message, []byte, error) {
+	total := 0
+	for {
+		n, contents, ignore, err := t.readPacket(nil)
+		total += n
+		if err != nil {
+			return total, nil, nil, err
+		}
+		if ignore {
+			continue
+		}
+		if len(contents) == 0 {
+			return total, nil, nil, messageError("", errors.New("empty v2 packet"))
+		}
+		var command string
+		payload := contents[1:]
+		switch id := contents[0]; {
+		case id == 0:
+			if len(contents) < longCommandSize {
+				return total, nil, nil, messageError("", errors.New("short v2 command"))
+			}
+			command = string(bytes.TrimRight(contents[1:longCommandSize], "\x00"))
+			payload = contents[longCommandSize:]
+		case int(id) < len(shortIDs) && shortIDs[id] != "":
+			command = shortIDs[id]
+		default:
+			return total, &MsgUnknown{Cmd: fmt.Sprintf("shortid %d", id), Payload: payload}, payload, nil
+		}
+		msg, err := decodeMessage(frameHeader(command, payload, t.btcnet), command, payload, pver, t.btcnet)
+		return total, msg, payload, err
+	}
+}
+
+func (t *v2) WriteMessage(msg wire.Message, pver uint32) error {
+	var payload bytes.Buffer
+	err := msg.BtcEncode(&payload, pver, wire.BaseEncoding)
+	if err != nil {
+		return err
+	}
+	if payload.Len() > int(msg.MaxPayloadLength(pver)) {
+		return fmt.Errorf("message payload is too large: %d bytes", payload.Len())
+	}
+	command := msg.Command()
+	contents := make([]byte, 0, longCommandSize+payload.Len())
+	if id, ok := shortIDByCommand[command]; ok {
+		contents = append(contents, id)
+	} else {
+		var long [longCommandSize]byte
+		copy(long[1:], command)
+		contents = append(contents, long[:]...)
+	}
+	contents = append(contents, payload.Bytes()...)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err = t.conn.Write(t.s.Encrypt(contents, nil, false))
+	return err
+}
+
+func (t *v2) RemoteAddr() net.Addr {
+	return t.conn.RemoteAddr()
+}
+
+func (t *v2) Close() error {
+	return t.conn.Close()
+}
+
+func (t *v2) Name() string {
+	return TransportV2
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Chain is a network definition file for forks and newer testnets
+// btcd has no params for, CHAIN=chains/testnet4.json
+type Chain struct {
+	// network name, used for the data files
+	Name string `json:"name"`
+	// consensus rules are taken from mainnet, testnet, signet or regtest
+	Base Network `json:"base"`
+	// message start bytes as they are sent, hex: 1c163f28
+	Magic string `json:"magic"`
+	Port  uint16 `json:"port"`
+	// protocol version we speak, ours if 0
+	Pver     uint32   `json:"pver,omitempty"`
+	DnsSeeds []string `json:"dns_seeds,omitempty"`
+	// ip, ip:port or [ipv6]:port, used when DNS seeds give nothing
+	FixedSeeds  []string `json:"fixed_seeds,omitempty"`
+	GenesisHash string   `json:"genesis_hash"`
+	// serialized 80 bytes genesis header in hex, needed for the header sync
+	GenesisHeader string `json:"genesis_header,omitempty"`
+	// BIP 94 difficulty and timewarp rules of testnet4
+	BIP94 bool `json:"bip94,omitempty"`
+}
+
+var chainName = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// LoadChain reads and validates the chain definition
+func LoadChain(path string) (*Chain, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chain file: %v", err)
+	}
+	var c Chain
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse chain file %s: %v", path, err)
+	}
+	if !chainName.MatchString(c.Name) {
+		return nil, fmt.Errorf("chain name %q should be lowercase letters, digits, - or _", c.Name)
+	}
+	if _, ok := baseParams[c.Base]; !ok {
+		return nil, fmt.Errorf("unknown chain base %q, expected mainnet, testnet, signet or regtest", c.Base)
+	}
+	if _, err = c.Btcnet(); err != nil {
+		return nil, err
+	}
+	if c.Port == 0 {
+		return nil, fmt.Errorf("chain port is not set")
+	}
+	// pings with a nonce keep the connection
+	if c.Pver != 0 && c.Pver < wire.BIP0031Version {
+		return nil, fmt.Errorf("chain pver %d is below %d", c.Pver, wire.BIP0031Version)
+	}
+	if _, err = c.Params(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// consensus params of the base networks
+var baseParams = map[Network]*chaincfg.Params{
+	NetworkMainnet: &chaincfg.MainNetParams,
+	NetworkTestnet: &chaincfg.TestNet3Params,
+	NetworkSignet:  &chaincfg.SigNetParams,
+	NetworkRegtest: &chaincfg.RegressionNetParams,
+}
+
+// Btcnet is the magic in the wire byte order
+func (c *Chain) Btcnet() (wire.BitcoinNet, error) {
+	magic, err := hex.DecodeString(c.Magic)
+	if err != nil || len(magic) != 4 {
+		return 0, fmt.Errorf("chain magic %q should be 4 bytes in hex", c.Magic)
+	}
+	return wire.BitcoinNet(binary.LittleEndian.Uint32(magic)), nil
+}
+
+// Params of the base network with the magic, port, seeds and genesis of the chain.
+// Checkpoints of the base are dropped.
+func (c *Chain) Params() (*chaincfg.Params, error) {
+	genesisHash, err := chainhash.NewHashFromStr(c.GenesisHash)
+	if err != nil {
+		return nil, fmt.Errorf("bad chain genesis hash %q: %v", c.GenesisHash, err)
+	}
+	btcnet, err := c.Btcnet()
+	if err != nil {
+		return nil, err
+	}
+	p := *baseParams[c.Base]
+	p.Name = c.Name
+	p.Net = btcnet
+	p.DefaultPort = fmt.Sprintf("%d", c.Port)
+	p.GenesisHash = genesisHash
+	p.GenesisBlock = nil
+	p.Checkpoints = nil
+	p.DNSSeeds = make([]chaincfg.DNSSeed, len(c.DnsSeeds))
+	for i, s := range c.DnsSeeds {
+		p.DNSSeeds[i] = chaincfg.DNSSeed{Host: s}
+	}
+	if c.GenesisHeader == "" {
+		return &p, nil
+	}
+	raw, err := hex.DecodeString(c.GenesisHeader)
+	if err != nil || len(raw) != wire.MaxBlockHeaderPayload {
+		return nil, fmt.Errorf("chain genesis header should be %d bytes in hex", wire.MaxBlockHeaderPayload)
+	}
+	var block wire.MsgBlock
+	err = block.Header.Deserialize(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("bad chain genesis header: %v", err)
+	}
+	if hash := block.Header.BlockHash(); hash != *genesisHash {
+		return nil, fmt.Errorf("chain genesis header hashes to %s, not to the genesis hash", hash)
+	}
+	p.GenesisBlock = &block
+	return &p, nil
+}
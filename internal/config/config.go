@@ -1,12 +1,18 @@
 package config
 
 import (
+	"encoding/hex"
+	"flag"
 	"fmt"
-	"log"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
 )
 
@@ -15,90 +21,288 @@ type Network string
 const (
 	NetworkMainnet Network = "mainnet"
 	NetworkTestnet Network = "testnet"
+	NetworkSignet  Network = "signet"
+	NetworkRegtest Network = "regtest"
 )
 
+// address family used for the bootstrap
+type Family string
+
+const (
+	FamilyAll  Family = ""
+	FamilyIPv4 Family = "ipv4"
+	FamilyIPv6 Family = "ipv6"
+)
+
+// VersionProfile is how the crawler presents itself in the version message
+type VersionProfile struct {
+	UserAgent string           `yaml:"user_agent" env:"USER_AGENT" help:"user agent in the version message"`
+	Services  wire.ServiceFlag `yaml:"services" env:"SERVICES" help:"service bits in the version message"`
+	// advertised best block height
+	StartHeight int32 `yaml:"start_height" env:"START_HEIGHT" help:"start height in the version message"`
+	// take start height from the best known chain height instead
+	StartHeightAuto bool `yaml:"start_height_auto" help:"advertise the height of the synced header chain"`
+	// ask peers to relay transactions
+	Relay bool `yaml:"relay" env:"RELAY" help:"relay flag in the version message"`
+	// send the real peer address as addr_recv instead of a loopback one
+	AddrRecv bool `yaml:"addr_recv" env:"ADDR_RECV" help:"send the real peer address as addr_recv"`
+}
+
+// BlockRef is a block to download, by hash or a range of heights
+type BlockRef struct {
+	Hash *chainhash.Hash
+	From int32
+	To   int32
+}
+
+// heights in one BLOCKS range
+const maxBlockRange = 1000
+
+// Config is read from the defaults, the config file, env and flags,
+// in this order, later ones win. Fields without a yaml key are derived.
 type Config struct {
-	Network          Network
-	NodesFilename    string
-	NodesPort        uint16
-	NodeTimeout      time.Duration
-	PingInterval     time.Duration
-	PingTimeout      time.Duration
-	PingRetrys       int
-	ListenInterval   time.Duration
-	ConnectionsLimit int
-	LogsDir          string
-	LogsFilename     string
-	DataDir          string
-
-	DnsAddress string
-	DnsTimeout time.Duration
-	DnsSeeds   []string
-
-	Gui bool
+	// config file it was loaded from
+	File string `yaml:"-"`
+
+	// mainnet, testnet, signet or regtest
+	Network Network `yaml:"network" env:"NETWORK" help:"network to crawl: mainnet, testnet, signet or regtest"`
+	// custom signet, hex of the block challenge script
+	SignetChallenge string `yaml:"signet_challenge" env:"SIGNET_CHALLENGE" help:"custom signet block challenge script in hex"`
+	// chain definition file, replaces the network
+	ChainFile string `yaml:"chain" env:"CHAIN" help:"chain definition file for forks and new testnets"`
+
+	// network name for the data files: the network, signet_<magic>
+	// for a custom signet or the name from the chain file
+	Name Network `yaml:"-"`
+
+	// network defaults are used for the zero values
+	NodesFilename    string        `yaml:"nodes_filename" env:"NODES_FILENAME" help:"good nodes file in the data dir, <network>.json by default"`
+	NodesPort        uint16        `yaml:"nodes_port" env:"NODES_PORT" help:"default port of the network"`
+	NodeTimeout      time.Duration `yaml:"node_timeout" env:"NODE_TIMEOUT" help:"connect and handshake timeout"`
+	PingInterval     time.Duration `yaml:"ping_interval" env:"PING_INTERVAL" help:"ping interval while waiting for addresses"`
+	PingRetrys       int           `yaml:"ping_retries" env:"PING_RETRIES" help:"pings sent while waiting for addresses"`
+	ConnectionsLimit int           `yaml:"connections" env:"CONN" help:"max concurrent connections, 50 or 10 with debug by default"`
+	LogsDir          string        `yaml:"logs_dir" env:"LOGS_DIR" help:"logs directory"`
+	LogsFilename     string        `yaml:"-"`
+	DataDir          string        `yaml:"data_dir" env:"DATA_DIR" help:"data directory for nodes and reports"`
+
+	// resolvers chain: "system", host[:port] or https:// DoH endpoints
+	DnsServers []string `yaml:"dns_servers" env:"DNS_SERVERS" help:"resolvers chain: system, host[:port] or https:// DoH endpoints"`
+	// udp (with tcp fallback on truncated answers) or tcp
+	DnsNet string `yaml:"dns_net" env:"DNS_NET" help:"dns transport: udp or tcp"`
+	// DNS-over-HTTPS endpoint tried before other resolvers
+	DnsDoH     string        `yaml:"dns_doh" env:"DNS_DOH" help:"DNS-over-HTTPS endpoint tried first"`
+	DnsTimeout time.Duration `yaml:"dns_timeout" env:"DNS_TIMEOUT" help:"timeout of one dns query"`
+	// whole dns bootstrap, fixed seeds are used after it
+	DnsScanTimeout time.Duration `yaml:"dns_scan_timeout" env:"DNS_SCAN_TIMEOUT" help:"timeout of the whole dns bootstrap"`
+	DnsSeeds       []string      `yaml:"dns_seeds" env:"DNS_SEEDS" help:"dns seeds of the network"`
+	DnsFamily      Family        `yaml:"dns_family" env:"DNS_FAMILY" help:"bootstrap address family: ipv4 or ipv6, both if empty"`
+	// seeds asked concurrently
+	DnsConcurrency int `yaml:"dns_concurrency" env:"DNS_CONCURRENCY" help:"dns seeds asked concurrently"`
+	// required services, seeds are asked for the x<hex>.seed subdomain
+	DnsServices wire.ServiceFlag `yaml:"dns_services" env:"DNS_SERVICES" help:"required service bits, x<hex> seed subdomain"`
+
+	// bootstrap files: peers.dat, getnodeaddresses json or host:port lists
+	SeedFiles []string `yaml:"seeds" env:"SEEDS" help:"seed files: peers.dat, getnodeaddresses json or host:port lists"`
+
+	// offline geoip, MaxMind mmdb files
+	GeoCountryDB string `yaml:"geoip_country" env:"GEOIP_COUNTRY" help:"MaxMind country mmdb file"`
+	GeoCityDB    string `yaml:"geoip_city" env:"GEOIP_CITY" help:"MaxMind city mmdb file"`
+	GeoASNDB     string `yaml:"geoip_asn" env:"GEOIP_ASN" help:"MaxMind ASN mmdb file"`
+
+	Gui      bool `yaml:"gui" env:"GUI" help:"terminal UI"`
+	GuiMem   bool `yaml:"gui_mem" env:"GUI_MEM" help:"memory usage in the UI instead of messages"`
+	GuiDebug bool `yaml:"gui_debug" env:"GUI_DEBUG" help:"random UI data for debugging"`
+	// debug logging and fewer connections
+	Debug bool `yaml:"debug" env:"DEBUG" help:"debug logging, 10 connections by default"`
+	// no crawl, for debugging other parts
+	DryRun bool `yaml:"dry_run" env:"DRY_RUN" help:"do not crawl"`
+	// pprof http address, empty disables it
+	Pprof string `yaml:"pprof" env:"PPROF" help:"pprof http address, localhost:6060"`
+
+	// dns seeder, `xray seed` mode
+	SeedZone    string        `yaml:"seed_zone" env:"SEED_ZONE" help:"seeder zone, seed.example.com"`             // zone we are authoritative for, seed.example.com
+	SeedNS      string        `yaml:"seed_ns" env:"SEED_NS" help:"seeder name server, ns.example.com"`            // name server of the zone, ns.example.com
+	SeedMbox    string        `yaml:"seed_mbox" env:"SEED_MBOX" help:"seeder SOA contact"`                        // SOA contact, hostmaster.<zone> by default
+	SeedListen  string        `yaml:"seed_listen" env:"SEED_LISTEN" help:"seeder udp and tcp address"`            // udp and tcp address to serve on
+	SeedTTL     time.Duration `yaml:"seed_ttl" env:"SEED_TTL" help:"seeder answers ttl"`                          // ttl of the answers
+	SeedRecords int           `yaml:"seed_records" env:"SEED_RECORDS" help:"seeder max records in one answer"`    // max records in one answer
+	SeedMaxAge  time.Duration `yaml:"seed_max_age" env:"SEED_MAX_AGE" help:"seeder serves nodes verified within"` // serve nodes verified within this period
+	SeedRecheck time.Duration `yaml:"seed_recheck" env:"SEED_RECHECK" help:"seeder re-verifies good nodes every"` // re-verify good nodes with this interval
 
 	// Wire
-	Pver uint32
+	Pver uint32 `yaml:"pver" env:"PVER" help:"protocol version"`
+
+	// outbound version message
+	Version VersionProfile `yaml:"version"`
+
+	// feature messages, sent only when the negotiated version supports them
+	SendHeaders bool  `yaml:"sendheaders" env:"SENDHEADERS" help:"send sendheaders, BIP 130"`             // BIP 130, announce blocks with headers
+	FeeFilter   int64 `yaml:"feefilter" env:"FEEFILTER" help:"send feefilter with the fee rate, sat/kvB"` // BIP 133, min fee rate sat/kvB, 0 disables
+	WtxidRelay  bool  `yaml:"wtxidrelay" env:"WTXIDRELAY" help:"send wtxidrelay, BIP 339"`                // BIP 339, announce transactions by wtxid
+
+	// addr harvest after getaddr: stay connected up to the window,
+	// until the getaddr answer or until AddrTarget addresses if set
+	AddrWindow time.Duration `yaml:"addr_window" env:"ADDR_WINDOW" help:"max time to wait for addresses after getaddr"`
+	AddrTarget int           `yaml:"addr_target" env:"ADDR_TARGET" help:"disconnect after this many addresses, getaddr answer if 0"`
+
+	// BIP 324, try the encrypted transport first, v1 if the peer refuses it
+	V2Transport bool `yaml:"v2transport" env:"V2TRANSPORT" help:"try BIP 324 v2 transport first"`
+
+	// header sync, peers are checked against a validated header chain
+	HeaderSync     bool          `yaml:"headers" env:"HEADERS" help:"sync and validate the header chain"`
+	HeadersTimeout time.Duration `yaml:"headers_timeout" env:"HEADERS_TIMEOUT" help:"headers answer timeout"`
+	// blocks behind our tip before a peer is lagging
+	HeaderLag int32 `yaml:"header_lag" env:"HEADER_LAG" help:"blocks behind the tip before a peer is lagging"`
+
+	// blocks downloaded from every NODE_NETWORK peer, heights need header sync
+	BlocksList    []string      `yaml:"blocks" env:"BLOCKS" help:"blocks to download: heights, from-to ranges and hashes"`
+	Blocks        []BlockRef    `yaml:"-"`
+	BlocksDir     string        `yaml:"blocks_dir" env:"BLOCKS_DIR" help:"downloaded blocks directory"`
+	BlocksTimeout time.Duration `yaml:"blocks_timeout" env:"BLOCKS_TIMEOUT" help:"block answer timeout"`
+	// ask peers for a deep historic and a recent block to detect pruning
+	PruneProbe bool `yaml:"prune_probe" env:"PRUNE_PROBE" help:"detect pruned nodes by the blocks they serve"`
+
+	// stay connected and record inv announcements with receive timestamps
+	Observe         bool          `yaml:"observe" env:"OBSERVE" help:"stay connected and record announcements"`
+	ObserveDuration time.Duration `yaml:"observe_duration" env:"OBSERVE_DURATION" help:"observation per connection, until exit if 0"` // per connection, 0 keeps it until exit
+	ObserveEvents   bool          `yaml:"observe_events" env:"OBSERVE_EVENTS" help:"write every announcement to the events log"`      // write every announcement to the events log
 
 	// var btcnet = wire.MainNet
-	Btcnet wire.BitcoinNet
+	Btcnet wire.BitcoinNet `yaml:"-"`
+	// consensus params: genesis, pow limit, retarget, checkpoints
+	Params *chaincfg.Params `yaml:"-"`
+	// rules btcd params have no fields for
+	PowNoRetarget bool `yaml:"-"` // regtest
+	EnforceBIP94  bool `yaml:"-"` // testnet4
+	// fixed seeds from the chain file, replace the compiled-in list
+	FixedSeeds []string `yaml:"-"`
 }
 
-func New() *Config {
-	cfg := &Config{
-		// var dnsAddress = "1.1.1.1:53" // cloudflare dns, 2x slower
-		// google dns
-		// DnsAddress:     "8.8.8.8:53",
-		// cloudflare dns
-		DnsAddress: "1.1.1.1:53",
-		// quad dns
-		// DnsAddress:     "9.9.9.9:53",
-
-		Pver:           wire.ProtocolVersion, // 70016
+// config file used when there is no --config and XRAY_CONFIG
+const defaultFile = "xray.yaml"
+
+// Load reads the defaults, the config file, env and, if fs is not nil,
+// the flags from args, then validates the result.
+// Every call returns a new config, it is passed down to the packages.
+// Flags of fs registered before are parsed as well, flags can follow
+// the positional arguments, those are returned.
+func Load(fs *flag.FlagSet, args []string) (*Config, []string, error) {
+	cfg := defaults()
+	cfg.File = configFile(args)
+	if cfg.File != "" {
+		err := cfg.loadFile(cfg.File)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	err := cfg.loadEnv()
+	if err != nil {
+		return nil, nil, err
+	}
+	var rest []string
+	if fs != nil {
+		cfg.bindFlags(fs)
+		err = fs.Parse(args)
+		for err == nil && fs.NArg() > 0 {
+			rest = append(rest, fs.Arg(0))
+			err = fs.Parse(fs.Args()[1:])
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	err = cfg.resolve()
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, rest, nil
+}
+
+func defaults() *Config {
+	return &Config{
+		Network: NetworkMainnet,
+		// system resolver first, cloudflare and google as a fallback
+		DnsServers: []string{"system", "1.1.1.1:53", "8.8.8.8:53"},
+		DnsNet:     "udp",
+
+		Pver: wire.ProtocolVersion, // 70016
+		Version: VersionProfile{
+			UserAgent: "/btcwire:0.5.0/btcd:0.23.3/",
+			Services:  wire.SFNodeNetwork,
+			Relay:     true,
+		},
 		NodeTimeout:    5 * time.Second,
 		PingInterval:   1 * time.Minute,
-		PingTimeout:    15 * time.Second,
 		PingRetrys:     3,
-		ListenInterval: 1 * time.Second,
+		AddrWindow:     30 * time.Second,
+		DnsConcurrency: 4,
+		DnsScanTimeout: 30 * time.Second,
 		LogsDir:        "logs",
 		LogsFilename:   fmt.Sprintf("logs_%s.log", time.Now().Format("2006-01-02_15-04-05")),
 		DataDir:        "data",
-		Gui:            os.Getenv("GUI") != "0", // enabled by default
+		Gui:            true,
+		SeedListen:     ":53",
+		SeedTTL:        1 * time.Minute,
+		SeedRecords:    25,
+		SeedMaxAge:     1 * time.Hour,
+		SeedRecheck:    30 * time.Minute,
+		HeadersTimeout: 30 * time.Second,
+		HeaderLag:      6,
+		BlocksDir:      filepath.Join("data", "blocks"),
+		BlocksTimeout:  30 * time.Second,
+		ObserveEvents:  true,
 		// Pver: 70013,
 	}
-	if os.Getenv("DEBUG") == "1" {
-		cfg.ConnectionsLimit = 10
-	} else {
-		cfg.ConnectionsLimit = 50
-	}
-	// override connections limit
-	if os.Getenv("CONN") != "" {
-		conn, err := strconv.Atoi(os.Getenv("CONN"))
-		if err != nil {
-			log.Fatalf("error converting CONN env variable to int: %v", err)
+}
+
+// configFile from --config, XRAY_CONFIG or xray.yaml if it exists
+func configFile(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
 		}
-		cfg.ConnectionsLimit = conn
-	}
-	if os.Getenv("TESTNET") == "1" {
-		cfg.Network = NetworkTestnet
-		cfg.Btcnet = wire.TestNet3
-		cfg.DnsTimeout = 10 * time.Second
-		cfg.NodesFilename = "testnet.json"
-		cfg.NodesPort = 18333
-		cfg.DnsSeeds = []string{
-			"testnet-seed.bitcoin.jonasschnelli.ch",
-			"seed.tbtc.petertodd.org",
-			"seed.testnet.bitcoin.sprovoost.nl",
-			"testnet-seed.bluematt.me",
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(args) {
+			return args[i+1]
 		}
-	} else {
-		cfg.Network = NetworkMainnet
-		cfg.Btcnet = wire.MainNet
+	}
+	if path := os.Getenv("XRAY_CONFIG"); path != "" {
+		return path
+	}
+	if _, err := os.Stat(defaultFile); err == nil {
+		return defaultFile
+	}
+	return ""
+}
+
+// resolve derives the network params and the network defaults,
+// then validates the settings
+func (cfg *Config) resolve() error {
+	var errs []string
+	fail := func(key string, format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
 
-		cfg.DnsTimeout = 5 * time.Second
-		cfg.NodesFilename = "mainnet.json"
-		cfg.NodesPort = 8333
-		cfg.DnsSeeds = []string{
+	var port uint16
+	var dnsTimeout time.Duration
+	var dnsSeeds []string
+	network := cfg.Network
+	if cfg.SignetChallenge != "" && network != NetworkSignet {
+		fail("signet_challenge", "needs network signet, got %s", network)
+	}
+	switch network {
+	case NetworkMainnet:
+		cfg.Params = &chaincfg.MainNetParams
+		dnsTimeout = 5 * time.Second
+		port = 8333
+		dnsSeeds = []string{
 			"dnsseed.emzy.de",
 			"dnsseed.bluematt.me",
 			"dnsseed.bitcoin.dashjr.org",
@@ -110,6 +314,229 @@ func New() *Config {
 			"seed.bitcoin.wiz.biz",
 			"seed.bitnodes.io",
 		}
+	case NetworkTestnet:
+		cfg.Params = &chaincfg.TestNet3Params
+		dnsTimeout = 10 * time.Second
+		port = 18333
+		dnsSeeds = []string{
+			"testnet-seed.bitcoin.jonasschnelli.ch",
+			"seed.tbtc.petertodd.org",
+			"seed.testnet.bitcoin.sprovoost.nl",
+			"testnet-seed.bluematt.me",
+		}
+	case NetworkSignet:
+		cfg.Params = &chaincfg.SigNetParams
+		dnsTimeout = 10 * time.Second
+		port = 38333
+		dnsSeeds = []string{
+			"seed.signet.bitcoin.sprovoost.nl",
+			"seed.signet.achownodes.xyz",
+		}
+		// custom signet, magic is derived from the challenge,
+		// the public seeds serve the default signet only
+		if cfg.SignetChallenge != "" {
+			challenge, err := hex.DecodeString(cfg.SignetChallenge)
+			if err != nil || len(challenge) == 0 {
+				fail("signet_challenge", "expected hex script, got %q", cfg.SignetChallenge)
+				break
+			}
+			params := chaincfg.CustomSignetParams(challenge, nil)
+			cfg.Params = &params
+			network = Network(fmt.Sprintf("signet_%08x", uint32(params.Net)))
+			dnsSeeds = nil
+		}
+	case NetworkRegtest:
+		// no seeds, peers come from seed files or the fixed list (localhost)
+		cfg.Params = &chaincfg.RegressionNetParams
+		dnsTimeout = 5 * time.Second
+		port = 18444
+		cfg.PowNoRetarget = true
+	default:
+		fail("network", "unknown network %q, expected mainnet, testnet, signet or regtest", network)
+		cfg.Params = &chaincfg.MainNetParams
+	}
+	// chain definition file replaces the network
+	if cfg.ChainFile != "" {
+		chain, err := LoadChain(cfg.ChainFile)
+		if err != nil {
+			fail("chain", "%v", err)
+		} else {
+			// validated by LoadChain
+			cfg.Params, _ = chain.Params()
+			network = Network(chain.Name)
+			port = chain.Port
+			dnsSeeds = chain.DnsSeeds
+			cfg.FixedSeeds = chain.FixedSeeds
+			cfg.PowNoRetarget = chain.Base == NetworkRegtest
+			cfg.EnforceBIP94 = chain.BIP94
+			if chain.Pver != 0 {
+				cfg.Pver = chain.Pver
+			}
+			if chain.Base != NetworkMainnet {
+				dnsTimeout = 10 * time.Second
+			}
+		}
+	}
+	// custom networks are named after the magic or the chain
+	cfg.Name = network
+	cfg.Btcnet = cfg.Params.Net
+	if cfg.NodesPort == 0 {
+		cfg.NodesPort = port
+	}
+	if cfg.DnsTimeout == 0 {
+		cfg.DnsTimeout = dnsTimeout
+	}
+	// an empty list in the file or env disables the dns seeds
+	if cfg.DnsSeeds == nil {
+		cfg.DnsSeeds = dnsSeeds
+	}
+	if cfg.NodesFilename == "" {
+		cfg.NodesFilename = string(cfg.Name) + ".json"
+	}
+	if cfg.ConnectionsLimit == 0 {
+		cfg.ConnectionsLimit = 50
+		if cfg.Debug {
+			cfg.ConnectionsLimit = 10
+		}
+	}
+
+	// blocks
+	cfg.Blocks = nil
+	for _, v := range cfg.BlocksList {
+		ref, err := parseBlockRef(v)
+		if err != nil {
+			fail("blocks", "%v", err)
+			continue
+		}
+		if ref.Hash == nil && !cfg.HeaderSync {
+			fail("blocks", "heights need header sync, enable headers or use block hashes")
+		}
+		cfg.Blocks = append(cfg.Blocks, ref)
+	}
+	if cfg.HeaderSync && cfg.Params.GenesisBlock == nil {
+		fail("headers", "header sync needs the genesis header, set genesis_header in the chain file")
+	}
+
+	// limits
+	if cfg.ConnectionsLimit < 0 {
+		fail("connections", "should be positive, got %d", cfg.ConnectionsLimit)
+	}
+	positive := map[string]time.Duration{
+		"node_timeout":     cfg.NodeTimeout,
+		"ping_interval":    cfg.PingInterval,
+		"addr_window":      cfg.AddrWindow,
+		"dns_timeout":      cfg.DnsTimeout,
+		"dns_scan_timeout": cfg.DnsScanTimeout,
+		"headers_timeout":  cfg.HeadersTimeout,
+		"blocks_timeout":   cfg.BlocksTimeout,
+		"seed_ttl":         cfg.SeedTTL,
+		"seed_max_age":     cfg.SeedMaxAge,
+		"seed_recheck":     cfg.SeedRecheck,
+	}
+	for key, d := range positive {
+		if d <= 0 {
+			fail(key, "should be a positive duration, got %v", d)
+		}
+	}
+	if cfg.ObserveDuration < 0 {
+		fail("observe_duration", "should not be negative, got %v", cfg.ObserveDuration)
+	}
+	if cfg.PingRetrys < 0 {
+		fail("ping_retries", "should not be negative, got %d", cfg.PingRetrys)
+	}
+	if cfg.AddrTarget < 0 {
+		fail("addr_target", "should not be negative, got %d", cfg.AddrTarget)
+	}
+	if cfg.FeeFilter < 0 {
+		fail("feefilter", "should not be negative, got %d sat/kvB", cfg.FeeFilter)
+	}
+	if cfg.HeaderLag < 0 {
+		fail("header_lag", "should not be negative, got %d", cfg.HeaderLag)
+	}
+	if cfg.DnsConcurrency < 1 {
+		fail("dns_concurrency", "should be at least 1, got %d", cfg.DnsConcurrency)
+	}
+	if cfg.SeedRecords < 1 {
+		fail("seed_records", "should be at least 1, got %d", cfg.SeedRecords)
+	}
+	if cfg.Pver < wire.BIP0031Version {
+		fail("pver", "should be at least %d, got %d", wire.BIP0031Version, cfg.Pver)
+	}
+	if cfg.Version.StartHeight < 0 {
+		fail("version.start_height", "should not be negative, got %d", cfg.Version.StartHeight)
+	}
+	if len(cfg.Version.UserAgent) > wire.MaxUserAgentLen {
+		fail("version.user_agent", "is too long, max %d", wire.MaxUserAgentLen)
+	}
+
+	// dns
+	switch cfg.DnsNet {
+	case "udp", "tcp":
+	default:
+		fail("dns_net", "unknown %q, expected udp or tcp", cfg.DnsNet)
+	}
+	switch cfg.DnsFamily {
+	case FamilyAll, FamilyIPv4, FamilyIPv6:
+	default:
+		fail("dns_family", "unknown %q, expected ipv4 or ipv6", cfg.DnsFamily)
+	}
+	if len(cfg.DnsServers) == 0 {
+		fail("dns_servers", "no resolvers, use system for /etc/resolv.conf")
+	}
+
+	// directories
+	dirs := map[string]string{
+		"logs_dir":   cfg.LogsDir,
+		"data_dir":   cfg.DataDir,
+		"blocks_dir": cfg.BlocksDir,
+	}
+	for key, dir := range dirs {
+		if dir == "" {
+			fail(key, "should not be empty")
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.Strings(errs)
+	return fmt.Errorf("invalid config:\n  %s\nsettings come from the config file, env and flags, see xray -h", strings.Join(errs, "\n  "))
+}
+
+// parseBlockRef parses a height, a from-to range or a block hash
+func parseBlockRef(s string) (BlockRef, error) {
+	if len(s) == chainhash.MaxHashStringSize {
+		hash, err := chainhash.NewHashFromStr(s)
+		if err != nil {
+			return BlockRef{}, fmt.Errorf("bad block hash %q: %v", s, err)
+		}
+		return BlockRef{Hash: hash}, nil
+	}
+	from, to, isRange := strings.Cut(s, "-")
+	start, err := strconv.ParseInt(from, 10, 32)
+	if err != nil || start < 0 {
+		return BlockRef{}, fmt.Errorf("bad block height %q", s)
+	}
+	end := start
+	if isRange {
+		end, err = strconv.ParseInt(to, 10, 32)
+		if err != nil || end < start {
+			return BlockRef{}, fmt.Errorf("bad block range %q", s)
+		}
+	}
+	if end-start >= maxBlockRange {
+		return BlockRef{}, fmt.Errorf("block range %q is over %d blocks", s, maxBlockRange)
+	}
+	return BlockRef{From: int32(start), To: int32(end)}, nil
+}
+
+// comma separated list, empty entries are skipped
+func splitList(s string) []string {
+	ret := make([]string, 0)
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			ret = append(ret, v)
+		}
 	}
-	return cfg
+	return ret
 }
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "xray.yaml")
+	err := os.WriteFile(path, []byte(data), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write the config file: %v", err)
+	}
+	return path
+}
+
+func flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("xray", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+func TestLoadDefaults(t *testing.T) {
+	t.Setenv("XRAY_CONFIG", writeFile(t, ""))
+	cfg, rest, err := Load(nil, nil)
+	if err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+	if len(rest) != 0 {
+		t.Errorf("rest %v, want none", rest)
+	}
+	if cfg.Network != NetworkMainnet || cfg.Name != NetworkMainnet || cfg.NodesPort != 8333 {
+		t.Errorf("network %s name %s port %d", cfg.Network, cfg.Name, cfg.NodesPort)
+	}
+	if cfg.NodesFilename != "mainnet.json" || cfg.ConnectionsLimit != 50 || len(cfg.DnsSeeds) == 0 {
+		t.Errorf("nodes file %s, connections %d, seeds %v", cfg.NodesFilename, cfg.ConnectionsLimit, cfg.DnsSeeds)
+	}
+}
+
+// file, then env, then flags, later ones win
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, `
+network: testnet
+node_timeout: 7s
+ping_retries: 5
+dns_net: tcp
+dns_seeds: []
+version:
+  user_agent: /file/
+`)
+	t.Setenv("XRAY_CONFIG", path)
+	t.Setenv("NODE_TIMEOUT", "9s")
+	t.Setenv("PING_RETRIES", "6")
+	t.Setenv("DNS_SERVERS", "system, 9.9.9.9:53")
+
+	fs := flagSet()
+	args := []string{"--node-timeout", "11s", "203.0.113.7:18333", "--version-user-agent=/flag/", "--debug"}
+	cfg, rest, err := Load(fs, args)
+	if err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+	if len(rest) != 1 || rest[0] != "203.0.113.7:18333" {
+		t.Errorf("rest %v, want the endpoint", rest)
+	}
+	if cfg.File != path {
+		t.Errorf("file %s, want %s", cfg.File, path)
+	}
+	// flag over env over file
+	if cfg.NodeTimeout != 11*time.Second {
+		t.Errorf("node_timeout %v, want the flag", cfg.NodeTimeout)
+	}
+	if cfg.Version.UserAgent != "/flag/" {
+		t.Errorf("user agent %s, want the flag", cfg.Version.UserAgent)
+	}
+	// env over file
+	if cfg.PingRetrys != 6 {
+		t.Errorf("ping_retries %d, want the env", cfg.PingRetrys)
+	}
+	if strings.Join(cfg.DnsServers, ",") != "system,9.9.9.9:53" {
+		t.Errorf("dns_servers %v, want the env", cfg.DnsServers)
+	}
+	// file over defaults, network defaults for the rest
+	if cfg.DnsNet != "tcp" || cfg.Network != NetworkTestnet || cfg.NodesPort != 18333 {
+		t.Errorf("dns_net %s, network %s, port %d", cfg.DnsNet, cfg.Network, cfg.NodesPort)
+	}
+	// empty list in the file disables the seeds
+	if cfg.DnsSeeds == nil || len(cfg.DnsSeeds) != 0 {
+		t.Errorf("dns_seeds %v, want empty", cfg.DnsSeeds)
+	}
+	// debug lowers the connections
+	if !cfg.Debug || cfg.ConnectionsLimit != 10 {
+		t.Errorf("debug %v, connections %d", cfg.Debug, cfg.ConnectionsLimit)
+	}
+
+	// --config wins over XRAY_CONFIG
+	other := writeFile(t, "network: signet\n")
+	cfg, _, err = Load(flagSet(), []string{"--config", other})
+	if err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+	if cfg.File != other || cfg.Network != NetworkSignet {
+		t.Errorf("file %s network %s, want %s signet", cfg.File, cfg.Network, other)
+	}
+}
+
+func TestLoadValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		// every key is in the error
+		want []string
+	}{
+		{
+			name: "unknown file key",
+			file: "node_timeuot: 5s\n",
+			want: []string{"node_timeuot"},
+		},
+		{
+			name: "bad env",
+			env:  map[string]string{"NODE_TIMEOUT": "soon", "CONN": "many"},
+			want: []string{"invalid env", "NODE_TIMEOUT", "CONN"},
+		},
+		{
+			name: "bad flag",
+			args: []string{"--ping-retries", "few"},
+			want: []string{"ping-retries"},
+		},
+		{
+			name: "invalid values",
+			args: []string{"--network", "moonnet", "--dns-net", "quic", "--connections", "-1", "--node-timeout", "0s"},
+			want: []string{"network:", "dns_net:", "connections:", "node_timeout:"},
+		},
+		{
+			name: "heights without headers",
+			file: "blocks: [\"100-200\"]\n",
+			want: []string{"blocks:", "header sync"},
+		},
+		{
+			name: "signet challenge on mainnet",
+			env:  map[string]string{"SIGNET_CHALLENGE": "51"},
+			want: []string{"signet_challenge:"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XRAY_CONFIG", writeFile(t, tt.file))
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			_, _, err := Load(flagSet(), tt.args)
+			if err == nil {
+				t.Fatalf("loaded, want an error with %v", tt.want)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(err.Error(), w) {
+					t.Errorf("error %q does not mention %q", err, w)
+				}
+			}
+		})
+	}
+}
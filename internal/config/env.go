@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// loadEnv applies the env variables of the settings over the config file
+func (cfg *Config) loadEnv() error {
+	var errs []string
+	// shortcuts kept from the env only configuration
+	if os.Getenv("TESTNET") == "1" && os.Getenv("NETWORK") == "" {
+		cfg.Network = NetworkTestnet
+	}
+	for _, f := range cfg.fields() {
+		s, ok := os.LookupEnv(f.env)
+		if f.env == "" || !ok {
+			continue
+		}
+		switch {
+		case f.key == "version.start_height" && s == "auto":
+			cfg.Version.StartHeightAuto = true
+			continue
+		case f.key == "pprof" && s == "1":
+			cfg.Pprof = "localhost:6060"
+			continue
+		case f.key == "pprof" && s == "0":
+			cfg.Pprof = ""
+			continue
+		}
+		err := f.Set(s)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", f.env, err))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.Strings(errs)
+	return fmt.Errorf("invalid env:\n  %s", strings.Join(errs, "\n  "))
+}
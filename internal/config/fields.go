@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// field is a setting with its yaml key, env name and help,
+// the same list is used by the config file, env and flags
+type field struct {
+	key  string
+	env  string
+	help string
+	v    reflect.Value
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	servicesType = reflect.TypeOf(wire.ServiceFlag(0))
+)
+
+// fields of the config with a yaml key, nested structs are prefixed with their key
+func (cfg *Config) fields() []field {
+	return walk(reflect.ValueOf(cfg).Elem(), "")
+}
+
+func walk(v reflect.Value, prefix string) []field {
+	var ret []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		key := sf.Tag.Get("yaml")
+		if key == "" || key == "-" {
+			continue
+		}
+		key = prefix + key
+		if sf.Type.Kind() == reflect.Struct {
+			ret = append(ret, walk(v.Field(i), key+".")...)
+			continue
+		}
+		ret = append(ret, field{
+			key:  key,
+			env:  sf.Tag.Get("env"),
+			help: sf.Tag.Get("help"),
+			v:    v.Field(i),
+		})
+	}
+	return ret
+}
+
+// Set parses the value from env or the command line
+func (f field) Set(s string) error {
+	v := f.v
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("expected duration like 30s, got %q", s)
+		}
+		v.SetInt(int64(d))
+	case v.Type() == servicesType:
+		// hex or decimal: 0x9 = NODE_NETWORK|NODE_WITNESS
+		sf, err := strconv.ParseUint(s, 0, 64)
+		if err != nil {
+			return fmt.Errorf("expected service bits like 0x9, got %q", s)
+		}
+		v.SetUint(sf)
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("expected 1 or 0, got %q", s)
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int, v.Kind() == reflect.Int32, v.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expected integer, got %q", s)
+		}
+		v.SetInt(n)
+	case v.Kind() == reflect.Uint16, v.Kind() == reflect.Uint32:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expected positive integer, got %q", s)
+		}
+		v.SetUint(n)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		// comma separated list, empty clears it
+		v.Set(reflect.ValueOf(splitList(s)))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+// String of the current value, in the form set accepts
+func (f field) String() string {
+	v := f.v
+	switch {
+	case !v.IsValid():
+		// zero flag value used by the flag package for the defaults
+		return ""
+	case v.Type() == durationType:
+		return time.Duration(v.Int()).String()
+	case v.Type() == servicesType:
+		return fmt.Sprintf("0x%x", v.Uint())
+	case v.Kind() == reflect.Slice:
+		return strings.Join(v.Interface().([]string), ",")
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
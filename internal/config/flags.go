@@ -0,0 +1,34 @@
+package config
+
+import (
+	"flag"
+	"reflect"
+	"strings"
+)
+
+// flagValue sets the config field from the command line
+type flagValue struct {
+	field
+}
+
+func (f flagValue) IsBoolFlag() bool {
+	return f.v.Kind() == reflect.Bool
+}
+
+// bindFlags registers a flag for every setting, version.user_agent is
+// --version-user-agent, defaults are the values from the file and env
+func (cfg *Config) bindFlags(fs *flag.FlagSet) {
+	fs.String("config", cfg.File, "config file (YAML), XRAY_CONFIG or ./"+defaultFile)
+	for _, f := range cfg.fields() {
+		help := f.help
+		if f.env != "" {
+			help += ", env " + f.env
+		}
+		fs.Var(flagValue{f}, FlagName(f.key), help)
+	}
+}
+
+// FlagName of the setting key
+func FlagName(key string) string {
+	return strings.NewReplacer("_", "-", ".", "-").Replace(key)
+}
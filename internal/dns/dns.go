@@ -2,81 +2,215 @@
 package dns
 
 import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
 	"time"
 
 	"github.com/1F47E/go-btc-xray/internal/config"
 	"github.com/1F47E/go-btc-xray/internal/logger"
 
+	"github.com/btcsuite/btcd/wire"
 	"github.com/miekg/dns"
 )
 
-var cfg = config.New()
-
 type DNS struct {
 	log       *logger.Logger
 	dnsSeeds  []string
-	dnsServer string
+	resolvers *chain
 	timeout   time.Duration
+	qtypes    []uint16
+	// max seeds asked at the same time
+	concurrency int
+	// required services filter, 0 asks the bare seed domain
+	services wire.ServiceFlag
 }
 
-func New(log *logger.Logger) *DNS {
+func New(cfg *config.Config, log *logger.Logger) *DNS {
 	// check config vars
-	if cfg.DnsSeeds == nil || cfg.DnsAddress == "" || cfg.DnsTimeout == 0 {
+	if cfg.DnsSeeds == nil || cfg.DnsTimeout == 0 || cfg.DnsConcurrency < 1 {
 		log.Fatal("dns config is not set")
 	}
+	servers := cfg.DnsServers
+	if cfg.DnsDoH != "" {
+		servers = append([]string{cfg.DnsDoH}, servers...)
+	}
+	resolvers, err := newChain(servers, cfg.DnsNet, cfg.DnsTimeout)
+	if err != nil {
+		log.Fatalf("dns config error: %v", err)
+	}
+	for _, r := range resolvers.members {
+		log.Debugf("[DNS]: resolver %s\n", r)
+	}
+	// query A and AAAA records unless limited to one family
+	var qtypes []uint16
+	switch cfg.DnsFamily {
+	case config.FamilyIPv4:
+		qtypes = []uint16{dns.TypeA}
+	case config.FamilyIPv6:
+		qtypes = []uint16{dns.TypeAAAA}
+	default:
+		qtypes = []uint16{dns.TypeA, dns.TypeAAAA}
+	}
 	return &DNS{
 		log:       log,
 		dnsSeeds:  cfg.DnsSeeds,
-		dnsServer: cfg.DnsAddress,
+		resolvers: resolvers,
 		timeout:   cfg.DnsTimeout,
+		qtypes:    qtypes,
+
+		concurrency: cfg.DnsConcurrency,
+		services:    cfg.DnsServices,
 	}
 }
 
-func (d *DNS) Scan() []string {
-	ips := make(map[string]struct{}, 0)
-	c := new(dns.Client)
-	m := new(dns.Msg)
-	c.Net = "tcp"
+// Result of the seeds scan
+type Result struct {
+	// unique node ips from all the seeds
+	Addrs []string
+	// answers tagged with the seed they came from
+	BySeed map[string][]string
+	// scan was interrupted before all the seeds answered
+	TimedOut bool
+}
+
+type seedAnswer struct {
+	seed string
+	ips  []net.IP
+}
+
+// Scan asks all the seeds concurrently, limited by cfg.DnsConcurrency.
+// On context cancel the answers received so far are returned.
+func (d *DNS) Scan(ctx context.Context) *Result {
+	answers := make(chan seedAnswer, len(d.dnsSeeds))
+	sem := make(chan struct{}, d.concurrency)
+	wg := sync.WaitGroup{}
 	for _, seed := range d.dnsSeeds {
-		d.log.Infof("[DNS]:[%s] asking for nodes\n", seed)
-		c.Timeout = cfg.DnsTimeout
-		m.SetQuestion(dns.Fqdn(seed), dns.TypeA)
-		in, _, err := c.Exchange(m, d.dnsServer)
-		if err != nil {
-			d.log.Warnf("[DNS]:[%s] error %v\n", seed, err)
-			continue
+		seed := seed
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case <-ctx.Done():
+				return
+			case sem <- struct{}{}:
+			}
+			defer func() { <-sem }()
+			answers <- seedAnswer{seed: seed, ips: d.resolveSeed(ctx, seed)}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(answers)
+	}()
+
+	// merge and deduplicate
+	res := &Result{
+		Addrs:  make([]string, 0),
+		BySeed: make(map[string][]string, len(d.dnsSeeds)),
+	}
+	ips := make(map[string]struct{}, 0)
+	for {
+		var ans seedAnswer
+		var ok bool
+		select {
+		case <-ctx.Done():
+			res.TimedOut = true
+			d.log.Warnf("[DNS]: scan timeout, %d of %d seeds answered\n", len(res.BySeed), len(d.dnsSeeds))
+		case ans, ok = <-answers:
 		}
-		if len(in.Answer) == 0 {
-			d.log.Warnf("[DNS]:[%s] no nodes found\n", seed)
-			continue
+		if !ok {
+			break
 		}
-		// loop through dns records
-		new := 0
-		for _, ans := range in.Answer {
-			// check that record is valid
-			if _, ok := ans.(*dns.A); !ok {
-				d.log.Warnf("[DNS]:[%s] invalid dns record, skipping\n", seed)
-				continue
-			}
-			// only add new ones
-			ip := ans.(*dns.A).A.String()
-			if _, ok := ips[ip]; ok {
-				d.log.Debugf("[DNS]:[%s] got duplicate ip %v\n", seed, ip)
+		tagged := make([]string, 0, len(ans.ips))
+		for _, ip := range ans.ips {
+			key := ip.String()
+			tagged = append(tagged, key)
+			if _, ok := ips[key]; ok {
+				d.log.Debugf("[DNS]:[%s] got duplicate ip %v\n", ans.seed, key)
 				continue
 			}
-			ips[ip] = struct{}{}
-			new++
+			ips[key] = struct{}{}
+			res.Addrs = append(res.Addrs, key)
 		}
-		if new > 0 {
-			d.log.Infof("[DNS]:[%s] found %d new nodes\n", seed, new)
+		res.BySeed[ans.seed] = tagged
+	}
+	d.log.Infof("[DNS]: finished scan. Got %d nodes from %d seeds\n", len(res.Addrs), len(d.dnsSeeds))
+	for _, h := range d.resolvers.health() {
+		if h.Failed > 0 {
+			d.log.Warnf("[DNS]:[%s] resolver ok: %d, failed: %d, last error: %v\n", h.Resolver, h.Ok, h.Failed, h.LastErr)
 		} else {
-			d.log.Debugf("[DNS]:[%s] no new nodes\n", seed)
+			d.log.Debugf("[DNS]:[%s] resolver ok: %d\n", h.Resolver, h.Ok)
+		}
+	}
+	return res
+}
+
+// resolveSeed asks one seed for all configured record types
+func (d *DNS) resolveSeed(ctx context.Context, seed string) []net.IP {
+	d.log.Infof("[DNS]:[%s] asking for nodes (%s)\n", seed, d.seedName(seed))
+	ret := make([]net.IP, 0)
+	// nodes per address family
+	cntV4, cntV6 := 0, 0
+	for _, qtype := range d.qtypes {
+		if ctx.Err() != nil {
+			return ret
+		}
+		found, err := d.query(ctx, seed, qtype)
+		if err != nil {
+			d.log.Warnf("[DNS]:[%s] %s error %v\n", seed, dns.TypeToString[qtype], err)
+			continue
+		}
+		for _, ip := range found {
+			if ip.To4() != nil {
+				cntV4++
+			} else {
+				cntV6++
+			}
 		}
+		ret = append(ret, found...)
 	}
-	d.log.Infof("[DNS]: finished scan. Got %d nodes from %d seeds\n", len(ips), len(d.dnsSeeds))
-	ret := make([]string, 0, len(ips))
-	for ip := range ips {
-		ret = append(ret, ip)
+	if len(ret) > 0 {
+		d.log.Infof("[DNS]:[%s] found %d nodes (ipv4: %d, ipv6: %d)\n", seed, len(ret), cntV4, cntV6)
+	} else {
+		d.log.Warnf("[DNS]:[%s] no nodes found\n", seed)
 	}
 	return ret
 }
+
+// seedName returns the service filtered subdomain of the seed,
+// seeds answer x9.seed.example.com with NODE_NETWORK|NODE_WITNESS nodes only
+func (d *DNS) seedName(seed string) string {
+	if d.services == 0 {
+		return dns.Fqdn(seed)
+	}
+	return dns.Fqdn(fmt.Sprintf("x%x.%s", uint64(d.services), seed))
+}
+
+// query one record type of the seed, returns A or AAAA addresses only
+func (d *DNS) query(ctx context.Context, seed string, qtype uint16) ([]net.IP, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(d.seedName(seed), qtype)
+	in, err := d.resolvers.exchange(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	if in.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("rcode %s", dns.RcodeToString[in.Rcode])
+	}
+	ret := make([]net.IP, 0, len(in.Answer))
+	// loop through dns records
+	for _, ans := range in.Answer {
+		switch rr := ans.(type) {
+		case *dns.A:
+			ret = append(ret, rr.A)
+		case *dns.AAAA:
+			ret = append(ret, rr.AAAA)
+		default:
+			// seeds may answer with CNAME, skip anything that is not an address
+			d.log.Debugf("[DNS]:[%s] skipping %s record\n", seed, dns.TypeToString[ans.Header().Rrtype])
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,220 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	resolvConf = "/etc/resolv.conf"
+	// upstream is skipped after this many failures in a row
+	maxFails = 3
+	// for this long
+	downTime = 30 * time.Second
+)
+
+// resolver sends a query to one upstream
+type resolver interface {
+	exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error)
+	String() string
+}
+
+// ===== plain dns over udp or tcp
+
+type upstream struct {
+	addr    string
+	net     string
+	timeout time.Duration
+}
+
+func (u *upstream) String() string {
+	return fmt.Sprintf("%s/%s", u.addr, u.net)
+}
+
+// udp answers that do not fit are retried over tcp
+func (u *upstream) exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	c := &dns.Client{Net: u.net, Timeout: u.timeout}
+	in, _, err := c.ExchangeContext(ctx, m, u.addr)
+	if err != nil {
+		return nil, err
+	}
+	if in.Truncated && u.net == "udp" {
+		c.Net = "tcp"
+		in, _, err = c.ExchangeContext(ctx, m, u.addr)
+	}
+	return in, err
+}
+
+// ===== DNS over HTTPS, RFC 8484
+
+type doh struct {
+	url    string
+	client *http.Client
+}
+
+func (d *doh) String() string {
+	return d.url
+}
+
+func (d *doh) exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	// id should be 0 for http caching
+	q := m.Copy()
+	q.Id = 0
+	packed, err := q.Pack()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http status %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, err
+	}
+	in := new(dns.Msg)
+	if err = in.Unpack(body); err != nil {
+		return nil, err
+	}
+	in.Id = m.Id
+	return in, nil
+}
+
+// ===== resolver chain with failover
+
+// Health of one upstream resolver
+type Health struct {
+	Resolver string
+	Ok       int
+	Failed   int
+	LastErr  error
+}
+
+type member struct {
+	resolver
+	fails     int
+	downUntil time.Time
+	health    Health
+}
+
+type chain struct {
+	mu      sync.Mutex
+	members []*member
+}
+
+// newChain builds the resolvers list from the config entries:
+// "system" - nameservers from /etc/resolv.conf,
+// "https://..." - DNS over HTTPS endpoint,
+// "host" or "host:port" - plain dns over udp or tcp
+func newChain(entries []string, network string, timeout time.Duration) (*chain, error) {
+	c := &chain{}
+	add := func(r resolver) {
+		c.members = append(c.members, &member{resolver: r, health: Health{Resolver: r.String()}})
+	}
+	for _, e := range entries {
+		switch {
+		case e == "system":
+			conf, err := dns.ClientConfigFromFile(resolvConf)
+			if err != nil {
+				// not fatal, other resolvers may work
+				continue
+			}
+			for _, s := range conf.Servers {
+				add(&upstream{addr: net.JoinHostPort(s, conf.Port), net: network, timeout: timeout})
+			}
+		case strings.HasPrefix(e, "https://"):
+			add(&doh{url: e, client: &http.Client{Timeout: timeout}})
+		default:
+			addr := e
+			if _, _, err := net.SplitHostPort(e); err != nil {
+				addr = net.JoinHostPort(e, "53")
+			}
+			add(&upstream{addr: addr, net: network, timeout: timeout})
+		}
+	}
+	if len(c.members) == 0 {
+		return nil, fmt.Errorf("no dns resolvers configured")
+	}
+	return c, nil
+}
+
+// exchange tries the resolvers in order, the ones failing recently go last.
+// SERVFAIL and REFUSED answers are tried on the next resolver
+// but do not count against the resolver health, seeds fail on their own.
+func (c *chain) exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	var lastErr error
+	var lastAnswer *dns.Msg
+	for _, mb := range c.candidates() {
+		in, err := mb.exchange(ctx, m)
+		c.mu.Lock()
+		if err != nil {
+			mb.fails++
+			mb.health.Failed++
+			mb.health.LastErr = err
+			if mb.fails >= maxFails {
+				mb.downUntil = time.Now().Add(downTime)
+			}
+			c.mu.Unlock()
+			lastErr = fmt.Errorf("%s: %w", mb, err)
+			continue
+		}
+		mb.fails = 0
+		mb.health.Ok++
+		c.mu.Unlock()
+		if in.Rcode == dns.RcodeServerFailure || in.Rcode == dns.RcodeRefused {
+			lastAnswer = in
+			continue
+		}
+		return in, nil
+	}
+	if lastAnswer != nil {
+		return lastAnswer, nil
+	}
+	return nil, lastErr
+}
+
+// healthy resolvers first, all of them if every one is down
+func (c *chain) candidates() []*member {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	up := make([]*member, 0, len(c.members))
+	down := make([]*member, 0)
+	for _, mb := range c.members {
+		if mb.downUntil.After(now) {
+			down = append(down, mb)
+		} else {
+			up = append(up, mb)
+		}
+	}
+	return append(up, down...)
+}
+
+func (c *chain) health() []Health {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ret := make([]Health, len(c.members))
+	for i, mb := range c.members {
+		ret[i] = mb.health
+	}
+	return ret
+}
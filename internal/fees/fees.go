@@ -0,0 +1,88 @@
+// Package fees summarizes the min fee rates peers announce with feefilter.
+package fees
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Sample is one feefilter received from a peer
+type Sample struct {
+	Time time.Time `json:"time"`
+	// sat/kvB
+	Fee int64 `json:"fee"`
+}
+
+// histogram bucket bounds in sat/kvB, 1000 is 1 sat/vB
+var bounds = []int64{1000, 2000, 5000, 10000, 20000, 50000, 100000}
+
+// Bucket counts fee rates in [From, To), To is 0 for the last one
+type Bucket struct {
+	From  int64 `json:"from"`
+	To    int64 `json:"to,omitempty"`
+	Count int   `json:"count"`
+}
+
+// Label of the bucket in sat/vB
+func (b Bucket) Label() string {
+	if b.To == 0 {
+		return fmt.Sprintf("%d+", b.From/1000)
+	}
+	if b.From == 0 {
+		return fmt.Sprintf("<%d", b.To/1000)
+	}
+	return fmt.Sprintf("%d", b.From/1000)
+}
+
+// Percentiles of the fee rates in sat/kvB
+type Percentiles struct {
+	P10 int64 `json:"p10"`
+	P25 int64 `json:"p25"`
+	P50 int64 `json:"p50"`
+	P75 int64 `json:"p75"`
+	P90 int64 `json:"p90"`
+	P99 int64 `json:"p99"`
+}
+
+type Summary struct {
+	Samples     int         `json:"samples"`
+	Percentiles Percentiles `json:"percentiles"`
+	Histogram   []Bucket    `json:"histogram"`
+}
+
+// Summarize the fee rates, one per peer
+func Summarize(fees []int64) *Summary {
+	s := &Summary{
+		Samples:   len(fees),
+		Histogram: make([]Bucket, len(bounds)+1),
+	}
+	var from int64
+	for i, to := range bounds {
+		s.Histogram[i] = Bucket{From: from, To: to}
+		from = to
+	}
+	s.Histogram[len(bounds)] = Bucket{From: from}
+	if len(fees) == 0 {
+		return s
+	}
+	sorted := make([]int64, len(fees))
+	copy(sorted, fees)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	for _, fee := range sorted {
+		i := sort.Search(len(bounds), func(i int) bool { return fee < bounds[i] })
+		s.Histogram[i].Count++
+	}
+	at := func(p float64) int64 {
+		return sorted[int(p*float64(len(sorted)-1))]
+	}
+	s.Percentiles = Percentiles{
+		P10: at(0.10),
+		P25: at(0.25),
+		P50: at(0.50),
+		P75: at(0.75),
+		P90: at(0.90),
+		P99: at(0.99),
+	}
+	return s
+}
@@ -0,0 +1,175 @@
+// offline geoip and asn lookups from local MaxMind mmdb files
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+type Info struct {
+	Country string `json:"country,omitempty"` // ISO 3166-1 code
+	City    string `json:"city,omitempty"`
+	ASN     uint   `json:"asn,omitempty"`
+	Org     string `json:"org,omitempty"`
+}
+
+type GeoIP struct {
+	country *maxminddb.Reader
+	city    *maxminddb.Reader
+	asn     *maxminddb.Reader
+}
+
+// record layouts of GeoLite2/GeoIP2 Country, City and ASN databases
+type countryRecord struct {
+	Country struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+
+type cityRecord struct {
+	Country struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+type asnRecord struct {
+	Number uint   `maxminddb:"autonomous_system_number"`
+	Org    string `maxminddb:"autonomous_system_organization"`
+}
+
+// New opens the databases, empty path skips the database
+func New(countryPath, cityPath, asnPath string) (*GeoIP, error) {
+	g := &GeoIP{}
+	var err error
+	open := func(path string) *maxminddb.Reader {
+		if path == "" || err != nil {
+			return nil
+		}
+		var r *maxminddb.Reader
+		r, err = maxminddb.Open(path)
+		if err != nil {
+			err = fmt.Errorf("failed to open %s: %v", path, err)
+		}
+		return r
+	}
+	g.country = open(countryPath)
+	g.city = open(cityPath)
+	g.asn = open(asnPath)
+	if err != nil {
+		_ = g.Close()
+		return nil, err
+	}
+	if g.country == nil && g.city == nil && g.asn == nil {
+		return nil, fmt.Errorf("no geoip databases configured")
+	}
+	return g, nil
+}
+
+func (g *GeoIP) Close() error {
+	var err error
+	for _, r := range []*maxminddb.Reader{g.country, g.city, g.asn} {
+		if r == nil {
+			continue
+		}
+		if e := r.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Lookup never fails, missing data is left empty
+func (g *GeoIP) Lookup(ip net.IP) Info {
+	var info Info
+	if ip == nil {
+		return info
+	}
+	if g.city != nil {
+		var rec cityRecord
+		if err := g.city.Lookup(ip, &rec); err == nil {
+			info.Country = rec.Country.IsoCode
+			info.City = rec.City.Names["en"]
+		}
+	}
+	if g.country != nil && info.Country == "" {
+		var rec countryRecord
+		if err := g.country.Lookup(ip, &rec); err == nil {
+			info.Country = rec.Country.IsoCode
+		}
+	}
+	if g.asn != nil {
+		var rec asnRecord
+		if err := g.asn.Lookup(ip, &rec); err == nil {
+			info.ASN = rec.Number
+			info.Org = rec.Org
+		}
+	}
+	return info
+}
+
+// ===== aggregates
+
+const unknown = "unknown"
+
+type Count struct {
+	Name  string `json:"name"`
+	Org   string `json:"org,omitempty"`
+	Count int    `json:"count"`
+}
+
+type Stats struct {
+	Total     int     `json:"total"`
+	Countries []Count `json:"countries"`
+	ASNs      []Count `json:"asns"`
+}
+
+// Summarize counts nodes per country and per ASN, sorted by count
+func Summarize(infos []Info) *Stats {
+	countries := make(map[string]int)
+	asns := make(map[uint]int)
+	orgs := make(map[uint]string)
+	for _, i := range infos {
+		c := i.Country
+		if c == "" {
+			c = unknown
+		}
+		countries[c]++
+		asns[i.ASN]++
+		if i.Org != "" {
+			orgs[i.ASN] = i.Org
+		}
+	}
+	s := &Stats{
+		Total:     len(infos),
+		Countries: make([]Count, 0, len(countries)),
+		ASNs:      make([]Count, 0, len(asns)),
+	}
+	for c, cnt := range countries {
+		s.Countries = append(s.Countries, Count{Name: c, Count: cnt})
+	}
+	for asn, cnt := range asns {
+		name := unknown
+		if asn != 0 {
+			name = fmt.Sprintf("AS%d", asn)
+		}
+		s.ASNs = append(s.ASNs, Count{Name: name, Org: orgs[asn], Count: cnt})
+	}
+	sortCounts(s.Countries)
+	sortCounts(s.ASNs)
+	return s
+}
+
+func sortCounts(c []Count) {
+	sort.Slice(c, func(i, j int) bool {
+		if c[i].Count != c[j].Count {
+			return c[i].Count > c[j].Count
+		}
+		return c[i].Name < c[j].Name
+	})
+}
@@ -5,19 +5,17 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
-	"os"
 	"runtime"
 	"strings"
 	"time"
 
 	"github.com/1F47E/go-btc-xray/internal/config"
+	"github.com/1F47E/go-btc-xray/internal/fees"
 
 	tui "github.com/gizak/termui/v3"
 	"github.com/gizak/termui/v3/widgets"
 )
 
-var cfg = config.New()
-
 const LEN_LOGS = 25
 const LEN_CONN = 14
 const LEN_NODES = 32
@@ -30,10 +28,15 @@ type IncomingData struct {
 	NodesQueued int
 	Log         string
 	Msg         string
+	// bootstrap source: dns or fixed seeds
+	Bootstrap string
+	// feefilter distribution, nil keeps the last one
+	Fees *fees.Summary
 }
 
 type GUI struct {
 	ctx             context.Context
+	cfg             *config.Config
 	ch              chan IncomingData
 	buffConnections []float64
 	buffNodesTotal  []float64
@@ -42,11 +45,14 @@ type GUI struct {
 	buffNodesDead   []float64
 	buffLogs        []string
 	buffMsgs        []string
+	bootstrap       string
+	fees            *fees.Summary
 }
 
-func New(ctx context.Context, ch chan IncomingData) *GUI {
+func New(ctx context.Context, cfg *config.Config, ch chan IncomingData) *GUI {
 	g := GUI{
 		ctx:             ctx,
+		cfg:             cfg,
 		ch:              ch,
 		buffConnections: make([]float64, LEN_CONN),
 		buffNodesTotal:  make([]float64, LEN_NODES),
@@ -72,6 +78,12 @@ func (g *GUI) listner() {
 			g.buffNodesDead = buffAddFloat(g.buffNodesDead, float64(d.NodesDead))
 			g.buffLogs = buffAddString(g.buffLogs, d.Log)
 			g.buffMsgs = buffAddString(g.buffMsgs, d.Msg)
+			if d.Bootstrap != "" {
+				g.bootstrap = d.Bootstrap
+			}
+			if d.Fees != nil {
+				g.fees = d.Fees
+			}
 		}
 	}
 }
@@ -122,7 +134,7 @@ func (g *GUI) Start() {
 	// CONNECTIONS
 	chartConn := widgets.NewSparkline()
 	// max connections
-	chartConn.MaxVal = float64(cfg.ConnectionsLimit)
+	chartConn.MaxVal = float64(g.cfg.ConnectionsLimit)
 	chartConn.Data = []float64{0}
 	chartConn.LineColor = tui.ColorMagenta
 	chartConn.TitleStyle.Fg = tui.ColorWhite
@@ -137,6 +149,7 @@ func (g *GUI) Start() {
 	stats.RowStyles[2] = tui.NewStyle(tui.ColorRed)
 	stats.RowStyles[3] = tui.NewStyle(tui.ColorYellow)
 	stats.RowStyles[4] = tui.NewStyle(tui.ColorMagenta)
+	stats.RowStyles[5] = tui.NewStyle(tui.ColorCyan)
 	stats.Rows = g.getInfo()
 	stats.TextStyle = tui.NewStyle(tui.ColorWhite)
 	tui.Render(stats)
@@ -177,6 +190,15 @@ func (g *GUI) Start() {
 	msg.Text = "Connecting..."
 	msg.Title = "Messages"
 
+	// FEES
+	chartFees := widgets.NewBarChart()
+	chartFees.Title = "Fee filter, sat/vB"
+	chartFees.BarWidth = 4
+	chartFees.BarGap = 1
+	chartFees.BarColors = []tui.Color{tui.ColorCyan}
+	chartFees.NumStyles = []tui.Style{tui.NewStyle(tui.ColorBlack)}
+	chartFees.LabelStyles = []tui.Style{tui.NewStyle(tui.ColorWhite)}
+
 	// construct the result grid
 	grid := tui.NewGrid()
 	termWidth, termHeight := tui.TerminalDimensions()
@@ -192,8 +214,9 @@ func (g *GUI) Start() {
 		),
 		// logs
 		tui.NewRow(0.65,
-			tui.NewCol(0.45, log),
-			tui.NewCol(0.45, msg),
+			tui.NewCol(0.35, log),
+			tui.NewCol(0.35, msg),
+			tui.NewCol(0.2, chartFees),
 			tui.NewCol(0.1, chartConnWrap),
 		),
 		// progress
@@ -204,7 +227,7 @@ func (g *GUI) Start() {
 	tui.Render(grid)
 
 	// send debug data
-	if os.Getenv("GUI_DEBUG") == "1" {
+	if g.cfg.GuiDebug {
 		go g.sendDebugData()
 	}
 
@@ -263,12 +286,13 @@ func (g *GUI) Start() {
 			updateTitlePlot(chartNodesGood, good, "Good")
 			updateTitlePlot(chartNodesDead, dead, "Dead")
 			updateTitleChart(chartConnWrap, conn, "Conn.")
+			updateFees(chartFees, g.fees)
 
 			// update info
 			stats.Rows = g.getInfo()
 
 			// debug info to logs
-			if os.Getenv("GUI_MEM") == "1" {
+			if g.cfg.GuiMem {
 				text := fmt.Sprintf("buffNodesTotal: len %d, cap %d\n", len(g.buffNodesTotal), cap(g.buffNodesTotal))
 				text += fmt.Sprintf("buffNodesQueued: len %d, cap %d\n", len(g.buffNodesQueued), cap(g.buffNodesQueued))
 				text += fmt.Sprintf("buffNodesGood: len %d, cap %d\n", len(g.buffNodesGood), cap(g.buffNodesGood))
@@ -293,8 +317,24 @@ func (g *GUI) getInfo() [][]string {
 		{"Good nodes", fmt.Sprintf("%.0f", g.buffNodesGood[LEN_NODES-1])},
 		{"Dead nodes", fmt.Sprintf("%.0f", g.buffNodesDead[LEN_NODES-1])},
 		{"Queue", fmt.Sprintf("%.0f", g.buffNodesQueued[LEN_NODES-1])},
-		{"Connections", fmt.Sprintf("%.0f/%d", g.buffConnections[LEN_CONN-1], cfg.ConnectionsLimit)},
+		{"Connections", fmt.Sprintf("%.0f/%d", g.buffConnections[LEN_CONN-1], g.cfg.ConnectionsLimit)},
+		{"Seeds", g.bootstrap},
+	}
+}
+
+// updateFees shows the histogram, median in the title
+func updateFees(chart *widgets.BarChart, s *fees.Summary) {
+	if s == nil || s.Samples == 0 {
+		return
+	}
+	chart.Data = make([]float64, len(s.Histogram))
+	chart.Labels = make([]string, len(s.Histogram))
+	for i, b := range s.Histogram {
+		chart.Data[i] = float64(b.Count)
+		chart.Labels[i] = b.Label()
 	}
+	chart.Title = fmt.Sprintf("Fee filter, sat/vB: p50 %.1f p90 %.1f (%d)",
+		float64(s.Percentiles.P50)/1000, float64(s.Percentiles.P90)/1000, s.Samples)
 }
 
 // update titles
@@ -322,11 +362,11 @@ func (g *GUI) sendDebugData() {
 			return
 		case <-ticker.C:
 			cnt++
-			rConn := rand.Intn(cfg.ConnectionsLimit)
-			rTotal := rand.Intn(cfg.ConnectionsLimit)
-			rQueued := rand.Intn(cfg.ConnectionsLimit)
-			rGood := rand.Intn(cfg.ConnectionsLimit)
-			rDead := rand.Intn(cfg.ConnectionsLimit)
+			rConn := rand.Intn(g.cfg.ConnectionsLimit)
+			rTotal := rand.Intn(g.cfg.ConnectionsLimit)
+			rQueued := rand.Intn(g.cfg.ConnectionsLimit)
+			rGood := rand.Intn(g.cfg.ConnectionsLimit)
+			rDead := rand.Intn(g.cfg.ConnectionsLimit)
 			g.ch <- IncomingData{
 				Connections: rConn,
 				NodesTotal:  rTotal,
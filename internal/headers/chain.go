@@ -0,0 +1,407 @@
+// Package headers keeps a validated in-memory header chain
+// built from getheaders/headers exchanges with the peers.
+// Only headers are checked: linkage, proof of work, difficulty
+// retarget, median time past and checkpoints. The chain with the most
+// work wins, weaker branches are kept to recognize peers on stale forks.
+package headers
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+var (
+	// headers do not attach to any header we know
+	ErrNotConnected = errors.New("headers do not connect")
+	// header failed validation, the peer sent bad data
+	ErrInvalid = errors.New("invalid header")
+)
+
+// MaxHeaders in one headers message, a full batch means the peer has more
+const MaxHeaders = wire.MaxBlockHeadersPerMsg
+
+const (
+	// timestamps further in the future are rejected
+	maxTimeOffset = 2 * time.Hour
+	// blocks in the median time past window
+	medianTimeBlocks = 11
+	// BIP 94, first block of a period can be this much before the last one
+	maxTimewarp = 600
+)
+
+// Rules are consensus rules btcd params have no fields for
+type Rules struct {
+	// regtest, difficulty never changes
+	NoRetarget bool
+	// BIP 94 (testnet4): retarget from the bits of the first block
+	// of the period and the timewarp limit on the period start
+	EnforceBIP94 bool
+}
+
+// Header is a position in the header chain
+type Header struct {
+	Hash   chainhash.Hash `json:"hash"`
+	Height int32          `json:"height"`
+}
+
+// Result of connecting a headers batch
+type Result struct {
+	Added int
+	Known int
+	// last header of the batch
+	Best Header
+	// the batch made a branch heavier than the main chain
+	Reorg bool
+}
+
+// entry is a validated header, parent links make side branches possible
+type entry struct {
+	hash      chainhash.Hash
+	parent    *entry
+	height    int32
+	bits      uint32
+	timestamp int64
+}
+
+type Chain struct {
+	mu     sync.RWMutex
+	params *chaincfg.Params
+	rules  Rules
+	// all validated headers, main chain and side branches
+	index map[chainhash.Hash]*entry
+	// main chain by height
+	main []*entry
+	// checkpoints by height
+	checkpoints map[int32]chainhash.Hash
+	// peer downloading the chain in bulk
+	syncer string
+}
+
+// New creates a chain with the genesis header of the network
+func New(params *chaincfg.Params, rules Rules) *Chain {
+	genesis := params.GenesisBlock.Header
+	e := &entry{
+		hash:      *params.GenesisHash,
+		bits:      genesis.Bits,
+		timestamp: genesis.Timestamp.Unix(),
+	}
+	c := &Chain{
+		params:      params,
+		rules:       rules,
+		index:       map[chainhash.Hash]*entry{e.hash: e},
+		main:        []*entry{e},
+		checkpoints: make(map[int32]chainhash.Hash, len(params.Checkpoints)),
+	}
+	for _, cp := range params.Checkpoints {
+		c.checkpoints[cp.Height] = *cp.Hash
+	}
+	return c
+}
+
+// Tip is the last header of the main chain
+func (c *Chain) Tip() Header {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e := c.main[len(c.main)-1]
+	return Header{Hash: e.hash, Height: e.height}
+}
+
+func (c *Chain) Height() int32 {
+	return c.Tip().Height
+}
+
+// HashAt returns the main chain header hash at the height
+func (c *Chain) HashAt(height int32) (chainhash.Hash, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if height < 0 || height >= int32(len(c.main)) {
+		return chainhash.Hash{}, false
+	}
+	return c.main[height].hash, true
+}
+
+// Lookup returns the position of a known header
+func (c *Chain) Lookup(hash chainhash.Hash) (Header, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e, ok := c.index[hash]
+	if !ok {
+		return Header{}, false
+	}
+	return Header{Hash: e.hash, Height: e.height}, true
+}
+
+// IsMain reports whether the header is on the main chain
+func (c *Chain) IsMain(hash chainhash.Hash) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e, ok := c.index[hash]
+	return ok && c.onMain(e)
+}
+
+// Locator returns the block locator starting from the header,
+// main chain tip if the header is unknown.
+// Last 10 headers one by one, then the step doubles down to genesis.
+func (c *Chain) Locator(from *chainhash.Hash) []*chainhash.Hash {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e := c.main[len(c.main)-1]
+	if from != nil {
+		if f, ok := c.index[*from]; ok {
+			e = f
+		}
+	}
+	ret := make([]*chainhash.Hash, 0, 32)
+	step := int32(1)
+	for e != nil {
+		hash := e.hash
+		ret = append(ret, &hash)
+		if e.height == 0 {
+			break
+		}
+		height := e.height - step
+		if height < 0 {
+			height = 0
+		}
+		e = c.ancestor(e, height)
+		if len(ret) > 10 {
+			step *= 2
+		}
+	}
+	return ret
+}
+
+// TrySync takes the bulk download lease, only one peer at a time
+// fetches the chain batch after batch, others ask for a single batch
+func (c *Chain) TrySync(peer string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.syncer != "" && c.syncer != peer {
+		return false
+	}
+	c.syncer = peer
+	return true
+}
+
+// DoneSync releases the lease if the peer holds it
+func (c *Chain) DoneSync(peer string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.syncer == peer {
+		c.syncer = ""
+	}
+}
+
+// Connect validates and adds a batch of consecutive headers.
+// Headers added before the invalid one stay in the chain.
+func (c *Chain) Connect(hdrs []*wire.BlockHeader) (*Result, error) {
+	res := &Result{}
+	if len(hdrs) == 0 {
+		return res, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prev, ok := c.index[hdrs[0].PrevBlock]
+	if !ok {
+		return res, fmt.Errorf("%w: unknown parent %s", ErrNotConnected, hdrs[0].PrevBlock)
+	}
+	now := time.Now()
+	for _, h := range hdrs {
+		if h.PrevBlock != prev.hash {
+			return res, fmt.Errorf("%w: not continuous at height %d", ErrInvalid, prev.height+1)
+		}
+		hash := h.BlockHash()
+		if e, ok := c.index[hash]; ok {
+			prev = e
+			res.Known++
+			continue
+		}
+		err := c.check(prev, h, &hash, now)
+		if err != nil {
+			c.result(res, prev)
+			return res, fmt.Errorf("%w: height %d %s: %v", ErrInvalid, prev.height+1, hash, err)
+		}
+		e := &entry{
+			hash:      hash,
+			parent:    prev,
+			height:    prev.height + 1,
+			bits:      h.Bits,
+			timestamp: h.Timestamp.Unix(),
+		}
+		c.index[hash] = e
+		// extends the main chain
+		if c.main[len(c.main)-1] == prev {
+			c.main = append(c.main, e)
+		}
+		prev = e
+		res.Added++
+	}
+	c.result(res, prev)
+	return res, nil
+}
+
+// result sets the best header and switches to the branch if it is heavier
+func (c *Chain) result(res *Result, best *entry) {
+	res.Best = Header{Hash: best.hash, Height: best.height}
+	if c.onMain(best) || !c.heavier(best) {
+		return
+	}
+	branch := make([]*entry, 0)
+	for e := best; !c.onMain(e); e = e.parent {
+		branch = append(branch, e)
+	}
+	fork := branch[len(branch)-1].parent.height
+	c.main = c.main[:fork+1]
+	for i := len(branch) - 1; i >= 0; i-- {
+		c.main = append(c.main, branch[i])
+	}
+	res.Reorg = true
+}
+
+// heavier compares the work of the branch and the main chain after the fork
+func (c *Chain) heavier(tip *entry) bool {
+	branchWork := new(big.Int)
+	e := tip
+	for ; !c.onMain(e); e = e.parent {
+		branchWork.Add(branchWork, blockchain.CalcWork(e.bits))
+	}
+	mainWork := new(big.Int)
+	for _, m := range c.main[e.height+1:] {
+		mainWork.Add(mainWork, blockchain.CalcWork(m.bits))
+	}
+	return branchWork.Cmp(mainWork) > 0
+}
+
+func (c *Chain) onMain(e *entry) bool {
+	return e.height < int32(len(c.main)) && c.main[e.height] == e
+}
+
+// ancestor of the entry at the height, main chain is indexed
+func (c *Chain) ancestor(e *entry, height int32) *entry {
+	if height < 0 || height > e.height {
+		return nil
+	}
+	for e != nil && e.height > height && !c.onMain(e) {
+		e = e.parent
+	}
+	if e == nil {
+		return nil
+	}
+	if e.height == height {
+		return e
+	}
+	return c.main[height]
+}
+
+// check the header against its parent
+func (c *Chain) check(prev *entry, h *wire.BlockHeader, hash *chainhash.Hash, now time.Time) error {
+	height := prev.height + 1
+	err := CheckProofOfWork(hash, h.Bits, c.params.PowLimit)
+	if err != nil {
+		return err
+	}
+	// difficulty
+	expected := c.nextBits(prev, h.Timestamp.Unix())
+	if h.Bits != expected {
+		return fmt.Errorf("bits %08x, expected %08x", h.Bits, expected)
+	}
+	// time
+	if h.Timestamp.Unix() <= c.medianTime(prev) {
+		return fmt.Errorf("timestamp is not after the median time past")
+	}
+	if h.Timestamp.After(now.Add(maxTimeOffset)) {
+		return fmt.Errorf("timestamp is too far in the future")
+	}
+	if c.rules.EnforceBIP94 && c.retargets(height) && h.Timestamp.Unix() < prev.timestamp-maxTimewarp {
+		return fmt.Errorf("timewarp, period starts before the previous block")
+	}
+	// checkpoints
+	if cp, ok := c.checkpoints[height]; ok && cp != *hash {
+		return fmt.Errorf("checkpoint mismatch")
+	}
+	if !c.onMain(prev) || c.main[len(c.main)-1] == prev {
+		return nil
+	}
+	// forks below the last passed checkpoint are not accepted
+	for cpHeight := range c.checkpoints {
+		if cpHeight >= height && cpHeight < int32(len(c.main)) {
+			return fmt.Errorf("fork below checkpoint %d", cpHeight)
+		}
+	}
+	return nil
+}
+
+// nextBits is the required difficulty of the header after prev
+func (c *Chain) nextBits(prev *entry, timestamp int64) uint32 {
+	p := c.params
+	if c.rules.NoRetarget {
+		return prev.bits
+	}
+	blocksPerRetarget := int32(p.TargetTimespan / p.TargetTimePerBlock)
+	if !c.retargets(prev.height + 1) {
+		if !p.ReduceMinDifficulty {
+			return prev.bits
+		}
+		// testnet: min difficulty block is allowed after 20 minutes
+		if timestamp > prev.timestamp+int64(p.MinDiffReductionTime/time.Second) {
+			return p.PowLimitBits
+		}
+		// otherwise the last non min difficulty bits
+		e := prev
+		for e.parent != nil && e.height%blocksPerRetarget != 0 && e.bits == p.PowLimitBits {
+			e = e.parent
+		}
+		return e.bits
+	}
+	// retarget with the timespan clamped by the adjustment factor
+	first := c.ancestor(prev, prev.height-(blocksPerRetarget-1))
+	if first == nil {
+		return p.PowLimitBits
+	}
+	targetTimespan := int64(p.TargetTimespan / time.Second)
+	minTimespan := targetTimespan / p.RetargetAdjustmentFactor
+	maxTimespan := targetTimespan * p.RetargetAdjustmentFactor
+	timespan := prev.timestamp - first.timestamp
+	if timespan < minTimespan {
+		timespan = minTimespan
+	} else if timespan > maxTimespan {
+		timespan = maxTimespan
+	}
+	// testnet min difficulty blocks at the period end do not lower the next one
+	bits := prev.bits
+	if c.rules.EnforceBIP94 {
+		bits = first.bits
+	}
+	newTarget := blockchain.CompactToBig(bits)
+	newTarget.Mul(newTarget, big.NewInt(timespan))
+	newTarget.Div(newTarget, big.NewInt(targetTimespan))
+	if newTarget.Cmp(p.PowLimit) > 0 {
+		newTarget.Set(p.PowLimit)
+	}
+	return blockchain.BigToCompact(newTarget)
+}
+
+// retargets reports whether the difficulty changes at the height
+func (c *Chain) retargets(height int32) bool {
+	p := c.params
+	return !c.rules.NoRetarget && height%int32(p.TargetTimespan/p.TargetTimePerBlock) == 0
+}
+
+// medianTime of the last 11 headers up to the entry
+func (c *Chain) medianTime(e *entry) int64 {
+	times := make([]int64, 0, medianTimeBlocks)
+	for ; e != nil && len(times) < medianTimeBlocks; e = e.parent {
+		times = append(times, e.timestamp)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	return times[len(times)/2]
+}
@@ -0,0 +1,209 @@
+package headers
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// mine makes a header on top of prev with a valid proof of work,
+// regtest targets take a few tries. version makes the branches differ
+func mine(t *testing.T, prev chainhash.Hash, version int32, timestamp time.Time, bits uint32) *wire.BlockHeader {
+	t.Helper()
+	h := &wire.BlockHeader{
+		Version:   version,
+		PrevBlock: prev,
+		Timestamp: timestamp,
+		Bits:      bits,
+	}
+	for ; h.Nonce < 1<<20; h.Nonce++ {
+		hash := h.BlockHash()
+		if blockchain.HashToBig(&hash).Cmp(blockchain.CompactToBig(bits)) <= 0 {
+			return h
+		}
+	}
+	t.Fatalf("failed to mine a header with bits %08x", bits)
+	return nil
+}
+
+// branch mines n headers with the parent bits after the parent, spacing apart
+func branch(t *testing.T, parent *wire.BlockHeader, n int, spacing time.Duration, version int32) []*wire.BlockHeader {
+	t.Helper()
+	ret := make([]*wire.BlockHeader, 0, n)
+	for i := 0; i < n; i++ {
+		h := mine(t, parent.BlockHash(), version, parent.Timestamp.Add(spacing), parent.Bits)
+		ret = append(ret, h)
+		parent = h
+	}
+	return ret
+}
+
+func regtest() *chaincfg.Params {
+	p := chaincfg.RegressionNetParams
+	p.Checkpoints = nil
+	return &p
+}
+
+func TestConnect(t *testing.T) {
+	params := regtest()
+	c := New(params, Rules{NoRetarget: true})
+	genesis := &params.GenesisBlock.Header
+	hdrs := branch(t, genesis, 5, time.Minute, 1)
+
+	res, err := c.Connect(hdrs)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	if res.Added != 5 || res.Reorg || c.Height() != 5 {
+		t.Fatalf("added %d, reorg %v, height %d", res.Added, res.Reorg, c.Height())
+	}
+	if want := hdrs[4].BlockHash(); c.Tip().Hash != want {
+		t.Errorf("tip %s, want %s", c.Tip().Hash, want)
+	}
+
+	// same batch again is known
+	res, err = c.Connect(hdrs)
+	if err != nil || res.Known != 5 || res.Added != 0 {
+		t.Errorf("second connect: known %d, added %d, err %v", res.Known, res.Added, err)
+	}
+
+	// unknown parent
+	orphan := mine(t, chainhash.Hash{1}, 1, hdrs[4].Timestamp.Add(time.Minute), genesis.Bits)
+	if _, err = c.Connect([]*wire.BlockHeader{orphan}); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("orphan: got %v, want %v", err, ErrNotConnected)
+	}
+
+	// timestamp at the median time past
+	old := mine(t, hdrs[4].BlockHash(), 1, hdrs[2].Timestamp, genesis.Bits)
+	if _, err = c.Connect([]*wire.BlockHeader{old}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("old timestamp: got %v, want %v", err, ErrInvalid)
+	}
+}
+
+func TestRetarget(t *testing.T) {
+	// retarget every 4 blocks
+	params := regtest()
+	params.TargetTimePerBlock = time.Minute
+	params.TargetTimespan = 4 * time.Minute
+	params.ReduceMinDifficulty = false
+	c := New(params, Rules{})
+	genesis := &params.GenesisBlock.Header
+
+	// blocks twice as fast as the target
+	hdrs := branch(t, genesis, 3, 30*time.Second, 1)
+	if _, err := c.Connect(hdrs); err != nil {
+		t.Fatalf("failed to connect the period: %v", err)
+	}
+
+	// timespan from the period start to its last block
+	timespan := int64(hdrs[2].Timestamp.Sub(genesis.Timestamp) / time.Second)
+	target := blockchain.CompactToBig(genesis.Bits)
+	target.Mul(target, big.NewInt(timespan))
+	target.Div(target, big.NewInt(int64(params.TargetTimespan/time.Second)))
+	want := blockchain.BigToCompact(target)
+	if want == genesis.Bits {
+		t.Fatalf("difficulty does not change")
+	}
+
+	// the old difficulty is rejected at the retarget height
+	stale := mine(t, hdrs[2].BlockHash(), 1, hdrs[2].Timestamp.Add(30*time.Second), genesis.Bits)
+	if _, err := c.Connect([]*wire.BlockHeader{stale}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("old bits at the retarget: got %v, want %v", err, ErrInvalid)
+	}
+
+	next := mine(t, hdrs[2].BlockHash(), 1, hdrs[2].Timestamp.Add(30*time.Second), want)
+	if _, err := c.Connect([]*wire.BlockHeader{next}); err != nil {
+		t.Fatalf("retarget bits %08x rejected: %v", want, err)
+	}
+
+	// and stays until the next period
+	after := mine(t, next.BlockHash(), 1, next.Timestamp.Add(30*time.Second), genesis.Bits)
+	if _, err := c.Connect([]*wire.BlockHeader{after}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("bits changed inside the period: got %v, want %v", err, ErrInvalid)
+	}
+}
+
+func TestReorg(t *testing.T) {
+	params := regtest()
+	c := New(params, Rules{NoRetarget: true})
+	genesis := &params.GenesisBlock.Header
+
+	main := branch(t, genesis, 3, time.Minute, 1)
+	if _, err := c.Connect(main); err != nil {
+		t.Fatalf("failed to connect the main chain: %v", err)
+	}
+
+	// same work does not switch
+	fork := branch(t, genesis, 4, time.Minute, 2)
+	res, err := c.Connect(fork[:3])
+	if err != nil {
+		t.Fatalf("failed to connect the fork: %v", err)
+	}
+	if res.Reorg || !c.IsMain(main[2].BlockHash()) || c.IsMain(fork[2].BlockHash()) {
+		t.Fatalf("equal work branch became the main chain")
+	}
+
+	// one more header makes it heavier
+	res, err = c.Connect(fork[3:])
+	if err != nil {
+		t.Fatalf("failed to extend the fork: %v", err)
+	}
+	if !res.Reorg {
+		t.Errorf("heavier branch did not reorg")
+	}
+	if c.Height() != 4 || c.Tip().Hash != fork[3].BlockHash() {
+		t.Errorf("tip %d %s, want 4 %s", c.Height(), c.Tip().Hash, fork[3].BlockHash())
+	}
+	for i, h := range fork {
+		if !c.IsMain(h.BlockHash()) {
+			t.Errorf("fork header %d is not on the main chain", i+1)
+		}
+	}
+	// the old branch is still known
+	if h, ok := c.Lookup(main[2].BlockHash()); !ok || h.Height != 3 || c.IsMain(h.Hash) {
+		t.Errorf("old tip lookup: %v %v", h, ok)
+	}
+}
+
+func TestCheckpoints(t *testing.T) {
+	params := regtest()
+	genesis := &params.GenesisBlock.Header
+	hdrs := branch(t, genesis, 4, time.Minute, 1)
+	cp := hdrs[1].BlockHash()
+	params.Checkpoints = []chaincfg.Checkpoint{{Height: 2, Hash: &cp}}
+	c := New(params, Rules{NoRetarget: true})
+
+	// other header at the checkpoint height
+	fork := branch(t, hdrs[0], 1, 2*time.Minute, 2)
+	if _, err := c.Connect(append([]*wire.BlockHeader{hdrs[0]}, fork...)); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("checkpoint mismatch: got %v, want %v", err, ErrInvalid)
+	}
+	if c.Height() != 1 {
+		t.Errorf("height %d, headers before the invalid one stay", c.Height())
+	}
+
+	if _, err := c.Connect(hdrs[1:]); err != nil {
+		t.Fatalf("failed to connect through the checkpoint: %v", err)
+	}
+
+	// forks below the passed checkpoint, even heavier ones
+	below := branch(t, genesis, 6, 2*time.Minute, 3)
+	if _, err := c.Connect(below); !errors.Is(err, ErrInvalid) {
+		t.Errorf("fork below the checkpoint: got %v, want %v", err, ErrInvalid)
+	}
+	if c.Tip().Hash != hdrs[3].BlockHash() {
+		t.Errorf("tip moved to %s", c.Tip().Hash)
+	}
+
+	// forks above it are fine
+	above := branch(t, hdrs[2], 1, 2*time.Minute, 4)
+	if _, err := c.Connect(above); err != nil {
+		t.Errorf("fork above the checkpoint: %v", err)
+	}
+}
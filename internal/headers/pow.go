@@ -0,0 +1,24 @@
+package headers
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// CheckProofOfWork checks the target is sane and the hash is below it
+func CheckProofOfWork(hash *chainhash.Hash, bits uint32, powLimit *big.Int) error {
+	target := blockchain.CompactToBig(bits)
+	if target.Sign() <= 0 {
+		return fmt.Errorf("target is not positive")
+	}
+	if target.Cmp(powLimit) > 0 {
+		return fmt.Errorf("target is above the pow limit")
+	}
+	if blockchain.HashToBig(hash).Cmp(target) > 0 {
+		return fmt.Errorf("hash is above the target")
+	}
+	return nil
+}
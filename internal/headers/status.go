@@ -0,0 +1,45 @@
+package headers
+
+// Status of the peer chain compared to our best chain
+type Status string
+
+const (
+	// not enough data, headers did not connect or the sync was cut short
+	StatusUnknown Status = ""
+	// best header is at our tip within the lag tolerance
+	StatusSynced Status = "synced"
+	// best header is on the main chain but behind
+	StatusLagging Status = "lagging"
+	// best header is on a branch with less work
+	StatusStaleFork Status = "stale_fork"
+	// version start height is above the headers the peer really has
+	StatusLying Status = "lying"
+	// peer sent headers failing validation
+	StatusInvalid Status = "invalid"
+)
+
+// Classify the peer by its best header.
+// complete is false if the peer may have more headers than we fetched,
+// claimed is the start height from the version message.
+func (c *Chain) Classify(best Header, complete bool, claimed int32, lag int32) Status {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e, ok := c.index[best.Hash]
+	if !ok {
+		return StatusUnknown
+	}
+	if !c.onMain(e) {
+		return StatusStaleFork
+	}
+	if !complete {
+		return StatusUnknown
+	}
+	if claimed > e.height+lag {
+		return StatusLying
+	}
+	tip := int32(len(c.main) - 1)
+	if e.height+lag < tip {
+		return StatusLagging
+	}
+	return StatusSynced
+}
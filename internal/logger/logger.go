@@ -15,8 +15,6 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-var cfg = config.New()
-
 type level string
 
 const (
@@ -29,21 +27,23 @@ const (
 
 type Logger struct {
 	*logrus.Logger
+	cfg   *config.Config
 	guiCh chan gui.IncomingData
 }
 
-func New(guiCh chan gui.IncomingData) *Logger {
+func New(cfg *config.Config, guiCh chan gui.IncomingData) *Logger {
 
-	log := initLogger()
-	return &Logger{log, guiCh}
+	log := initLogger(cfg, cfg.Gui)
+	return &Logger{log, cfg, guiCh}
 }
 
-func initLogger() *logrus.Logger {
+// initLogger writes to the logs file when the gui takes the terminal
+func initLogger(cfg *config.Config, toFile bool) *logrus.Logger {
 
 	log := logrus.New()
 
 	var format logrus.TextFormatter
-	if cfg.Gui {
+	if toFile {
 		path := filepath.Join(cfg.LogsDir, cfg.LogsFilename)
 		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 		if err == nil {
@@ -62,7 +62,7 @@ func initLogger() *logrus.Logger {
 		log.SetFormatter(&format)
 	}
 
-	if os.Getenv("DEBUG") == "1" {
+	if cfg.Debug {
 		log.SetLevel(logrus.DebugLevel)
 	} else {
 		log.SetLevel(logrus.InfoLevel)
@@ -72,8 +72,7 @@ func initLogger() *logrus.Logger {
 }
 
 func (l *Logger) ResetToStdout() {
-	os.Setenv("GUI", "0")
-	l.Logger = initLogger()
+	l.Logger = initLogger(l.cfg, false)
 }
 
 func (l *Logger) Close() error {
@@ -87,14 +86,14 @@ func (l *Logger) Close() error {
 
 // debug
 func (l *Logger) Debug(args ...interface{}) {
-	if os.Getenv("DEBUG") == "1" {
+	if l.cfg.Debug {
 		l.Logger.Debug(args...)
 		l.Ship("DEBUG", args...)
 	}
 }
 
 func (l *Logger) Debugf(format string, args ...interface{}) {
-	if os.Getenv("DEBUG") == "1" {
+	if l.cfg.Debug {
 		if !strings.HasSuffix(format, "\n") {
 			format += "\n"
 		}
@@ -0,0 +1,286 @@
+// Package observe records inventory announcements from all the connected
+// peers with receive timestamps and measures how fast items propagate:
+// the delay of every announcement after the first one and who is first.
+package observe
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Kind of the announced item
+type Kind string
+
+const (
+	KindTx    Kind = "tx"
+	KindWtx   Kind = "wtx"
+	KindBlock Kind = "block"
+)
+
+// InvTypeWTx announces a transaction by wtxid, BIP 339, btcd wire has no constant
+const InvTypeWTx wire.InvType = 5
+
+const (
+	// items first seen longer ago are forgotten, late announcements are not measured
+	itemTTL = 30 * time.Minute
+	// latency samples kept per peer, reservoir sampled
+	maxSamples = 10000
+)
+
+// kindOf maps the inventory type, false for items we do not track
+func kindOf(t wire.InvType) (Kind, bool) {
+	switch t {
+	case wire.InvTypeTx, wire.InvTypeWitnessTx:
+		return KindTx, true
+	case InvTypeWTx:
+		return KindWtx, true
+	case wire.InvTypeBlock, wire.InvTypeWitnessBlock, wire.InvTypeFilteredBlock, wire.InvTypeFilteredWitnessBlock:
+		return KindBlock, true
+	}
+	return "", false
+}
+
+// Event is one announcement, written to the events log as a json line
+type Event struct {
+	// receive time, unix nanoseconds
+	Time int64          `json:"t"`
+	Peer string         `json:"peer"`
+	Kind Kind           `json:"kind"`
+	Hash chainhash.Hash `json:"hash"`
+}
+
+type item struct {
+	first     time.Time
+	firstPeer string
+}
+
+type peerStats struct {
+	announcements int
+	// announced the item before anyone else
+	firsts  int
+	samples *samples
+}
+
+// Observer is safe for concurrent use by all the node listeners.
+// txid and wtxid of the same segwit transaction are different items,
+// peers with wtxidrelay announce by wtxid.
+type Observer struct {
+	mu    sync.Mutex
+	since time.Time
+	items map[chainhash.Hash]*item
+	kinds map[Kind]int
+	peers map[string]*peerStats
+	// first-seen latency over all the peers
+	all   *samples
+	total int
+	// block propagation race
+	races     map[chainhash.Hash]*race
+	raceOrder []chainhash.Hash
+	racePeers map[string]*racePeer
+	// optional events log
+	events *bufio.Writer
+	file   *os.File
+}
+
+// New creates an observer, events are appended to the file if the path is set
+func New(eventsPath string) (*Observer, error) {
+	o := &Observer{
+		since: time.Now(),
+		items: make(map[chainhash.Hash]*item),
+		kinds: make(map[Kind]int),
+		peers: make(map[string]*peerStats),
+		all:   newSamples(),
+
+		races:     make(map[chainhash.Hash]*race),
+		racePeers: make(map[string]*racePeer),
+	}
+	if eventsPath != "" {
+		f, err := os.OpenFile(eventsPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open events log: %v", err)
+		}
+		o.file = f
+		o.events = bufio.NewWriter(f)
+	}
+	return o, nil
+}
+
+// Inv records the announcements of one inv message received at t
+func (o *Observer) Inv(peer string, t time.Time, invs []*wire.InvVect) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, ok := o.peers[peer]
+	if !ok {
+		p = &peerStats{samples: newSamples()}
+		o.peers[peer] = p
+	}
+	for _, inv := range invs {
+		kind, ok := kindOf(inv.Type)
+		if !ok {
+			continue
+		}
+		o.total++
+		p.announcements++
+		o.log(Event{Time: t.UnixNano(), Peer: peer, Kind: kind, Hash: inv.Hash})
+		if kind == KindBlock {
+			o.block(peer, t, inv.Hash, ViaInv)
+		}
+		it, ok := o.items[inv.Hash]
+		if !ok {
+			o.items[inv.Hash] = &item{first: t, firstPeer: peer}
+			o.kinds[kind]++
+			p.firsts++
+			continue
+		}
+		// same peer announcing again is not a propagation
+		if it.firstPeer == peer {
+			continue
+		}
+		delay := t.Sub(it.first)
+		p.samples.add(delay)
+		o.all.add(delay)
+	}
+}
+
+func (o *Observer) log(e Event) {
+	if o.events == nil {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	_, _ = o.events.Write(append(data, '\n'))
+}
+
+// Flush writes the buffered events and forgets old items
+func (o *Observer) Flush() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	deadline := time.Now().Add(-itemTTL)
+	for hash, it := range o.items {
+		if it.first.Before(deadline) {
+			delete(o.items, hash)
+		}
+	}
+	if o.events == nil {
+		return nil
+	}
+	return o.events.Flush()
+}
+
+func (o *Observer) Close() error {
+	err := o.Flush()
+	if o.file != nil {
+		_ = o.file.Close()
+	}
+	return err
+}
+
+// Latency percentiles in milliseconds
+type Latency struct {
+	Samples int     `json:"samples"`
+	P10     float64 `json:"p10"`
+	P50     float64 `json:"p50"`
+	P90     float64 `json:"p90"`
+	P99     float64 `json:"p99"`
+}
+
+type PeerReport struct {
+	Peer          string `json:"peer"`
+	Announcements int    `json:"announcements"`
+	Firsts        int    `json:"firsts"`
+	// share of the items this peer announced first,
+	// far above the others may be a well connected spy node
+	FirstRatio float64 `json:"first_ratio"`
+	// delay of this peer announcements after the first one
+	Latency Latency `json:"latency"`
+}
+
+type Report struct {
+	Since         time.Time    `json:"since"`
+	Announcements int          `json:"announcements"`
+	Items         map[Kind]int `json:"items"`
+	Latency       Latency      `json:"latency"`
+	// sorted by the first announcements
+	Peers []PeerReport `json:"peers"`
+}
+
+func (o *Observer) Report() *Report {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	r := &Report{
+		Since:         o.since,
+		Announcements: o.total,
+		Items:         make(map[Kind]int, len(o.kinds)),
+		Latency:       o.all.latency(),
+		Peers:         make([]PeerReport, 0, len(o.peers)),
+	}
+	firstsTotal := 0
+	for k, v := range o.kinds {
+		r.Items[k] = v
+		firstsTotal += v
+	}
+	for peer, p := range o.peers {
+		pr := PeerReport{
+			Peer:          peer,
+			Announcements: p.announcements,
+			Firsts:        p.firsts,
+			Latency:       p.samples.latency(),
+		}
+		if firstsTotal > 0 {
+			pr.FirstRatio = float64(p.firsts) / float64(firstsTotal)
+		}
+		r.Peers = append(r.Peers, pr)
+	}
+	sort.Slice(r.Peers, func(i, j int) bool {
+		return r.Peers[i].Firsts > r.Peers[j].Firsts
+	})
+	return r
+}
+
+// samples is a fixed size reservoir of delays
+type samples struct {
+	seen int
+	vals []time.Duration
+}
+
+func newSamples() *samples {
+	return &samples{vals: make([]time.Duration, 0, 64)}
+}
+
+func (s *samples) add(d time.Duration) {
+	s.seen++
+	if len(s.vals) < maxSamples {
+		s.vals = append(s.vals, d)
+		return
+	}
+	if i := rand.Intn(s.seen); i < maxSamples {
+		s.vals[i] = d
+	}
+}
+
+func (s *samples) latency() Latency {
+	l := Latency{Samples: s.seen}
+	if len(s.vals) == 0 {
+		return l
+	}
+	sorted := make([]time.Duration, len(s.vals))
+	copy(sorted, s.vals)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	at := func(p float64) float64 {
+		d := sorted[int(p*float64(len(sorted)-1))]
+		return ms(d)
+	}
+	l.P10, l.P50, l.P90, l.P99 = at(0.10), at(0.50), at(0.90), at(0.99)
+	return l
+}
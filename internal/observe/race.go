@@ -0,0 +1,153 @@
+package observe
+
+import (
+	"sort"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// Via is the message a block was announced with
+type Via string
+
+const (
+	ViaInv     Via = "inv"
+	ViaHeaders Via = "headers"
+	ViaCmpct   Via = "cmpctblock"
+)
+
+// blocks kept for the race report, older ones are forgotten
+const maxRaces = 100
+
+type announce struct {
+	delay time.Duration
+	via   Via
+}
+
+// race of one block: when every peer announced it first
+type race struct {
+	hash      chainhash.Hash
+	first     time.Time
+	firstPeer string
+	peers     map[string]announce
+}
+
+type racePeer struct {
+	blocks int
+	firsts int
+	delay  time.Duration
+	via    map[Via]int
+}
+
+// Block records a block announcement, only the first one of every peer counts
+func (o *Observer) Block(peer string, t time.Time, hash chainhash.Hash, via Via) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.block(peer, t, hash, via)
+}
+
+func (o *Observer) block(peer string, t time.Time, hash chainhash.Hash, via Via) {
+	r, ok := o.races[hash]
+	if !ok {
+		r = &race{
+			hash:      hash,
+			first:     t,
+			firstPeer: peer,
+			peers:     make(map[string]announce),
+		}
+		o.races[hash] = r
+		o.raceOrder = append(o.raceOrder, hash)
+		if len(o.raceOrder) > maxRaces {
+			delete(o.races, o.raceOrder[0])
+			o.raceOrder = o.raceOrder[1:]
+		}
+	}
+	if _, ok := r.peers[peer]; ok {
+		return
+	}
+	delay := t.Sub(r.first)
+	r.peers[peer] = announce{delay: delay, via: via}
+	p, ok := o.racePeers[peer]
+	if !ok {
+		p = &racePeer{via: make(map[Via]int)}
+		o.racePeers[peer] = p
+	}
+	p.blocks++
+	p.delay += delay
+	p.via[via]++
+	if r.firstPeer == peer {
+		p.firsts++
+	}
+}
+
+type RaceEntry struct {
+	Peer    string  `json:"peer"`
+	DelayMs float64 `json:"delay_ms"`
+	Via     Via     `json:"via"`
+}
+
+type BlockRace struct {
+	Hash      chainhash.Hash `json:"hash"`
+	First     time.Time      `json:"first"`
+	FirstPeer string         `json:"first_peer"`
+	// sorted by the delay after the first announcement
+	Peers []RaceEntry `json:"peers"`
+}
+
+type RacePeer struct {
+	Peer       string      `json:"peer"`
+	Blocks     int         `json:"blocks"`
+	Firsts     int         `json:"firsts"`
+	AvgDelayMs float64     `json:"avg_delay_ms"`
+	Via        map[Via]int `json:"via"`
+}
+
+type RaceReport struct {
+	// newest first
+	Blocks []BlockRace `json:"blocks"`
+	// fastest first
+	Peers []RacePeer `json:"peers"`
+}
+
+// RaceReport shows how fast each block reached each peer
+func (o *Observer) RaceReport() *RaceReport {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	r := &RaceReport{
+		Blocks: make([]BlockRace, 0, len(o.raceOrder)),
+		Peers:  make([]RacePeer, 0, len(o.racePeers)),
+	}
+	for i := len(o.raceOrder) - 1; i >= 0; i-- {
+		race := o.races[o.raceOrder[i]]
+		br := BlockRace{
+			Hash:      race.hash,
+			First:     race.first,
+			FirstPeer: race.firstPeer,
+			Peers:     make([]RaceEntry, 0, len(race.peers)),
+		}
+		for peer, a := range race.peers {
+			br.Peers = append(br.Peers, RaceEntry{Peer: peer, DelayMs: ms(a.delay), Via: a.via})
+		}
+		sort.Slice(br.Peers, func(i, j int) bool { return br.Peers[i].DelayMs < br.Peers[j].DelayMs })
+		r.Blocks = append(r.Blocks, br)
+	}
+	for peer, p := range o.racePeers {
+		via := make(map[Via]int, len(p.via))
+		for k, v := range p.via {
+			via[k] = v
+		}
+		r.Peers = append(r.Peers, RacePeer{
+			Peer:       peer,
+			Blocks:     p.blocks,
+			Firsts:     p.firsts,
+			AvgDelayMs: ms(p.delay) / float64(p.blocks),
+			Via:        via,
+		})
+	}
+	sort.Slice(r.Peers, func(i, j int) bool { return r.Peers[i].AvgDelayMs < r.Peers[j].AvgDelayMs })
+	return r
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,251 @@
+// authoritative dns server for a bitcoin seed zone,
+// answers with a random subset of recently verified good nodes
+package seeder
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1F47E/go-btc-xray/internal/client/node"
+	"github.com/1F47E/go-btc-xray/internal/config"
+	"github.com/1F47E/go-btc-xray/internal/logger"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/miekg/dns"
+)
+
+// Peer is a good node served by the seeder
+type Peer struct {
+	IP       net.IP
+	Services wire.ServiceFlag
+}
+
+type Seeder struct {
+	cfg     *config.Config
+	log     *logger.Logger
+	zone    string
+	ns      string
+	mbox    string
+	ttl     uint32
+	records int
+
+	// pool of served nodes, replaced on every update
+	mu     sync.RWMutex
+	peers  []Peer
+	serial uint32
+	rnd    *rand.Rand
+}
+
+func New(cfg *config.Config, log *logger.Logger) (*Seeder, error) {
+	if cfg.SeedZone == "" || cfg.SeedNS == "" {
+		return nil, fmt.Errorf("seed zone and name server are not set")
+	}
+	mbox := cfg.SeedMbox
+	if mbox == "" {
+		mbox = "hostmaster." + cfg.SeedZone
+	}
+	return &Seeder{
+		cfg:     cfg,
+		log:     log,
+		zone:    dns.CanonicalName(cfg.SeedZone),
+		ns:      dns.CanonicalName(cfg.SeedNS),
+		mbox:    dns.CanonicalName(mbox),
+		ttl:     uint32(cfg.SeedTTL / time.Second),
+		records: cfg.SeedRecords,
+		serial:  uint32(time.Now().Unix()),
+		rnd:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+// Update replaces the pool of served nodes
+func (s *Seeder) Update(peers []Peer) {
+	s.mu.Lock()
+	s.peers = peers
+	s.serial = uint32(time.Now().Unix())
+	s.mu.Unlock()
+	s.log.Debugf("[SEEDER]: serving %d nodes\n", len(peers))
+}
+
+// Start serves udp and tcp until the context is canceled
+func (s *Seeder) Start(ctx context.Context) error {
+	servers := []*dns.Server{
+		{Addr: s.cfg.SeedListen, Net: "udp", Handler: s},
+		{Addr: s.cfg.SeedListen, Net: "tcp", Handler: s},
+	}
+	errCh := make(chan error, len(servers))
+	for _, srv := range servers {
+		srv := srv
+		go func() {
+			errCh <- srv.ListenAndServe()
+		}()
+	}
+	s.log.Infof("[SEEDER]: serving %s on %s\n", s.zone, s.cfg.SeedListen)
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errCh:
+	}
+	for _, srv := range servers {
+		_ = srv.Shutdown()
+	}
+	return err
+}
+
+// ServeDNS implements dns.Handler
+func (s *Seeder) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+	defer func() {
+		// udp answers fit the client buffer, 512 bytes without edns0,
+		// truncated ones are retried over tcp
+		if _, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+			size := dns.MinMsgSize
+			if opt := r.IsEdns0(); opt != nil {
+				size = int(opt.UDPSize())
+			}
+			m.Truncate(size)
+		}
+		_ = w.WriteMsg(m)
+	}()
+	if len(r.Question) != 1 {
+		m.Rcode = dns.RcodeFormatError
+		return
+	}
+	q := r.Question[0]
+	name := dns.CanonicalName(q.Name)
+	if !dns.IsSubDomain(s.zone, name) {
+		m.Authoritative = false
+		m.Rcode = dns.RcodeRefused
+		return
+	}
+
+	// zone apex or xNN. service filter subdomain
+	var services wire.ServiceFlag
+	if name != s.zone {
+		sub := strings.TrimSuffix(name, "."+s.zone)
+		sf, ok := parseFilter(sub)
+		if !ok {
+			m.Rcode = dns.RcodeNameError
+			m.Ns = []dns.RR{s.soa()}
+			return
+		}
+		services = sf
+	}
+
+	switch q.Qtype {
+	case dns.TypeA, dns.TypeAAAA:
+		m.Answer = s.answer(name, q.Qtype, services)
+	case dns.TypeNS:
+		if name == s.zone {
+			m.Answer = []dns.RR{s.nsRecord()}
+		}
+	case dns.TypeSOA:
+		if name == s.zone {
+			m.Answer = []dns.RR{s.soa()}
+		}
+	}
+	// NODATA answers carry SOA for negative caching
+	if len(m.Answer) == 0 {
+		m.Ns = []dns.RR{s.soa()}
+	}
+	s.log.Debugf("[SEEDER]: %s %s -> %d records\n", dns.TypeToString[q.Qtype], name, len(m.Answer))
+}
+
+// parseFilter parses x<hex> service bits subdomain, x9 = NODE_NETWORK|NODE_WITNESS
+func parseFilter(sub string) (wire.ServiceFlag, bool) {
+	if len(sub) < 2 || sub[0] != 'x' {
+		return 0, false
+	}
+	sf, err := strconv.ParseUint(sub[1:], 16, 64)
+	if err != nil {
+		return 0, false
+	}
+	return wire.ServiceFlag(sf), true
+}
+
+// answer picks a random subset of the nodes of the requested family and services
+func (s *Seeder) answer(name string, qtype uint16, services wire.ServiceFlag) []dns.RR {
+	// full lock, rand.Rand is not safe for concurrent use
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	matched := make([]Peer, 0)
+	for _, p := range s.peers {
+		if p.Services&services != services {
+			continue
+		}
+		if (p.IP.To4() != nil) != (qtype == dns.TypeA) {
+			continue
+		}
+		matched = append(matched, p)
+	}
+	s.rnd.Shuffle(len(matched), func(i, j int) {
+		matched[i], matched[j] = matched[j], matched[i]
+	})
+	if len(matched) > s.records {
+		matched = matched[:s.records]
+	}
+	hdr := dns.RR_Header{Name: name, Rrtype: qtype, Class: dns.ClassINET, Ttl: s.ttl}
+	ret := make([]dns.RR, len(matched))
+	for i, p := range matched {
+		if qtype == dns.TypeA {
+			ret[i] = &dns.A{Hdr: hdr, A: p.IP.To4()}
+		} else {
+			ret[i] = &dns.AAAA{Hdr: hdr, AAAA: p.IP}
+		}
+	}
+	return ret
+}
+
+func (s *Seeder) nsRecord() dns.RR {
+	return &dns.NS{
+		Hdr: dns.RR_Header{Name: s.zone, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 86400},
+		Ns:  s.ns,
+	}
+}
+
+func (s *Seeder) soa() dns.RR {
+	s.mu.RLock()
+	serial := s.serial
+	s.mu.RUnlock()
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: s.zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: s.ttl},
+		Ns:      s.ns,
+		Mbox:    s.mbox,
+		Serial:  serial,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  s.ttl,
+	}
+}
+
+// Watch refreshes the pool from the crawler good nodes until the context is canceled.
+// Only nodes on the default port verified within cfg.SeedMaxAge are served,
+// dns answers can not carry a port.
+func (s *Seeder) Watch(ctx context.Context, good func() []*node.Node) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		deadline := time.Now().Add(-s.cfg.SeedMaxAge)
+		peers := make([]Peer, 0)
+		for _, n := range good() {
+			if n.Port() != s.cfg.NodesPort || n.LastSeen().Before(deadline) {
+				continue
+			}
+			peers = append(peers, Peer{IP: n.IP(), Services: n.Services()})
+		}
+		s.Update(peers)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
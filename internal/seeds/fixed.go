@@ -0,0 +1,32 @@
+package seeds
+
+import (
+	"embed"
+	"fmt"
+)
+
+// Compiled-in seed nodes, used when DNS seeds give nothing.
+// Lists are imported from the bitcoin core contrib/seeds lists in contrib:
+//
+//	go generate ./internal/seeds
+//
+// or generated from the good nodes saved by a crawl:
+//
+//	go run ./internal/seeds/fixedgen -in data/mainnet.json -out internal/seeds/fixed/mainnet.txt
+//
+// regtest list is not generated, it points at a local node.
+//
+//go:generate go run ./fixedgen -core -in contrib/nodes_main.txt -out fixed/mainnet.txt
+//go:generate go run ./fixedgen -core -in contrib/nodes_test.txt -out fixed/testnet.txt
+//go:generate go run ./fixedgen -core -in contrib/nodes_signet.txt -out fixed/signet.txt
+//go:embed fixed/*.txt
+var fixedFS embed.FS
+
+// Fixed returns the fixed seeds of the network, port is used for the entries without one
+func Fixed(network string, port uint16) ([]Addr, error) {
+	data, err := fixedFS.ReadFile(fmt.Sprintf("fixed/%s.txt", network))
+	if err != nil {
+		return nil, fmt.Errorf("no fixed seeds for %s", network)
+	}
+	return ParseList(data, port)
+}
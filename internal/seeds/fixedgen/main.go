@@ -0,0 +1,117 @@
+// fixedgen regenerates fixed seeds list from the nodes saved by xray
+// or from the Bitcoin Core contrib/seeds lists
+//
+//	go run ./internal/seeds/fixedgen -in data/mainnet.json -out internal/seeds/fixed/mainnet.txt
+//	go run ./internal/seeds/fixedgen -core -in internal/seeds/contrib/nodes_main.txt -out internal/seeds/fixed/mainnet.txt
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/1F47E/go-btc-xray/internal/seeds"
+	"github.com/1F47E/go-btc-xray/internal/storage"
+)
+
+func main() {
+	in := flag.String("in", "", "nodes file saved by xray (data/mainnet.json) or a core list with -core")
+	core := flag.Bool("core", false, "input is bitcoin core contrib/seeds/nodes_*.txt")
+	out := flag.String("out", "", "fixed seeds list to write")
+	max := flag.Int("max", 512, "max nodes in the list")
+	flag.Parse()
+	if *in == "" || *out == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var endpoints []string
+	var err error
+	source := "good nodes"
+	if *core {
+		endpoints, err = loadCore(*in)
+		source = "bitcoin core seeds"
+	} else {
+		endpoints, err = loadNodes(*in)
+	}
+	if err != nil {
+		log.Fatalf("failed to load %s: %v", *in, err)
+	}
+	// keep the current list instead of an empty one
+	if len(endpoints) == 0 {
+		log.Fatalf("no addresses in %s", *in)
+	}
+	total := len(endpoints)
+	// stable output for the diffs,
+	// evenly spaced picks to not favor any address range
+	sort.Strings(endpoints)
+	if len(endpoints) > *max {
+		picked := make([]string, *max)
+		for i := range picked {
+			picked[i] = endpoints[i*len(endpoints) / *max]
+		}
+		endpoints = picked
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# fixed seeds, generated by fixedgen from %d %s on %s\n", total, source, time.Now().UTC().Format("2006-01-02"))
+	fmt.Fprintf(&buf, "# regenerate: go generate ./internal/seeds\n")
+	for _, e := range endpoints {
+		fmt.Fprintln(&buf, e)
+	}
+	if err = os.WriteFile(*out, buf.Bytes(), 0644); err != nil {
+		log.Fatalf("failed to write %s: %v", *out, err)
+	}
+	fmt.Printf("%d nodes written to %s\n", len(endpoints), *out)
+}
+
+func loadNodes(path string) ([]string, error) {
+	records, err := storage.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	endpoints := make([]string, 0, len(records))
+	for _, r := range records {
+		endpoints = append(endpoints, r.Endpoint)
+	}
+	return endpoints, nil
+}
+
+// cjdns addresses in core lists look like ipv6
+var cjdns = &net.IPNet{IP: net.ParseIP("fc00::"), Mask: net.CIDRMask(8, 128)}
+
+// loadCore reads ip:port lines of a core seeds list,
+// tor, i2p and cjdns addresses can not be dialed and are skipped
+func loadCore(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	endpoints := make([]string, 0)
+	skipped := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		a, err := seeds.ParseEndpoint(line, 0)
+		if err != nil || a.IP == nil || a.Port == 0 || cjdns.Contains(a.IP) {
+			skipped++
+			continue
+		}
+		endpoints = append(endpoints, a.Endpoint())
+	}
+	if skipped > 0 {
+		fmt.Printf("%d tor, i2p and cjdns addresses skipped\n", skipped)
+	}
+	return endpoints, nil
+}
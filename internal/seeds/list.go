@@ -0,0 +1,106 @@
+package seeds
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hostnames in the lists are resolved with this timeout
+const lookupTimeout = 5 * time.Second
+
+// ParseList parses plain text list of nodes, one per line.
+// Accepted formats: ip, ip:port, [ipv6]:port, host, host:port. Lines starting with # are ignored.
+// Hostnames are resolved at load time, every routable address is added.
+func ParseList(data []byte, port uint16) ([]Addr, error) {
+	ret := make([]Addr, 0)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	for sc.Scan() {
+		line++
+		s := trimComment(sc.Text())
+		if s == "" {
+			continue
+		}
+		addrs, err := ResolveEndpoint(s, port)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		ret = append(ret, addrs...)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ParseEndpoint parses ip, ip:port or [ipv6]:port. port is used when missing.
+// Not routable addresses give an Addr with nil IP.
+func ParseEndpoint(s string, port uint16) (Addr, error) {
+	var a Addr
+	host, port, err := splitEndpoint(s, port)
+	if err != nil {
+		return a, err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return a, fmt.Errorf("invalid ip %q", host)
+	}
+	if ip = routable(ip); ip != nil {
+		a.IP = ip
+		a.Port = port
+	}
+	return a, nil
+}
+
+// ResolveEndpoint is ParseEndpoint accepting hostnames as well,
+// returns the routable addresses of the host
+func ResolveEndpoint(s string, port uint16) ([]Addr, error) {
+	host, port, err := splitEndpoint(s, port)
+	if err != nil {
+		return nil, err
+	}
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+		defer cancel()
+		ipAddrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %q: %v", host, err)
+		}
+		for _, ia := range ipAddrs {
+			ips = append(ips, ia.IP)
+		}
+	}
+	ret := make([]Addr, 0, len(ips))
+	for _, ip := range ips {
+		if ip = routable(ip); ip != nil {
+			ret = append(ret, Addr{IP: ip, Port: port})
+		}
+	}
+	return ret, nil
+}
+
+// splitEndpoint splits host and port, port is used when missing
+func splitEndpoint(s string, port uint16) (string, uint16, error) {
+	// bare ipv6 or a host without port
+	if net.ParseIP(s) != nil || !strings.Contains(s, ":") {
+		return s, port, nil
+	}
+	h, p, err := net.SplitHostPort(s)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid endpoint %q: %v", s, err)
+	}
+	pn, err := strconv.ParseUint(p, 10, 16)
+	if err != nil || pn == 0 {
+		return "", 0, fmt.Errorf("invalid port in %q", s)
+	}
+	return h, uint16(pn), nil
+}
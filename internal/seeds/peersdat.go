@@ -0,0 +1,178 @@
+package seeds
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Bitcoin Core addrman serialization (src/addrman.cpp)
+//
+// magic | format | compat | key[32] | nNew | nTried | nUBuckets | entries... | buckets... | checksum[32]
+//
+// every entry is a CAddress (disk format) followed by the source CNetAddr,
+// last success time and number of attempts
+const (
+	addrmanFormatBIP155 = 3 // addrv2 encoding of the source address
+	addrmanCompatBase   = 32
+
+	// set in the disk version of CAddress when it is stored as addrv2
+	addrV2Format = 0x20000000
+
+	// BIP155 network ids
+	netIPv4 = 1
+	netIPv6 = 2
+
+	maxAddrSize = 512
+	maxEntries  = 1 << 20
+)
+
+// ParsePeersDat parses Bitcoin Core peers.dat file.
+// Only ipv4 and ipv6 addresses are returned, other networks are skipped.
+func ParsePeersDat(data []byte, magic wire.BitcoinNet) ([]Addr, error) {
+	if len(data) < 4+2+32+4*3+chainhash.HashSize {
+		return nil, fmt.Errorf("peers.dat is too short: %d bytes", len(data))
+	}
+	if !isPeersDat(data, magic) {
+		return nil, fmt.Errorf("peers.dat is for another network: %x", data[:4])
+	}
+	// checksum is a double sha256 of everything before it
+	body, sum := data[:len(data)-chainhash.HashSize], data[len(data)-chainhash.HashSize:]
+	if !bytes.Equal(chainhash.DoubleHashB(body), sum) {
+		return nil, fmt.Errorf("peers.dat checksum mismatch")
+	}
+
+	r := bytes.NewReader(body[4:])
+	var hdr struct {
+		Format uint8
+		Compat uint8
+		Key    [32]byte
+		New    int32
+		Tried  int32
+		Bucket int32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("failed to read peers.dat header: %v", err)
+	}
+	if hdr.Compat < addrmanCompatBase {
+		return nil, fmt.Errorf("unsupported peers.dat compat byte: %d", hdr.Compat)
+	}
+	total := int(hdr.New) + int(hdr.Tried)
+	if hdr.New < 0 || hdr.Tried < 0 || total > maxEntries {
+		return nil, fmt.Errorf("invalid peers.dat entries count: new %d, tried %d", hdr.New, hdr.Tried)
+	}
+
+	sourceV2 := hdr.Format >= addrmanFormatBIP155
+	ret := make([]Addr, 0, total)
+	for i := 0; i < total; i++ {
+		a, err := readAddrInfo(r, sourceV2)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read peers.dat entry %d: %v", i, err)
+		}
+		if a.IP == nil {
+			continue
+		}
+		ret = append(ret, a)
+	}
+	return ret, nil
+}
+
+// AddrInfo: CAddress, source CNetAddr, int64 last success, int32 attempts
+func readAddrInfo(r io.Reader, sourceV2 bool) (Addr, error) {
+	a, err := readAddress(r)
+	if err != nil {
+		return a, err
+	}
+	if _, err = readNetAddr(r, sourceV2); err != nil {
+		return a, fmt.Errorf("source: %v", err)
+	}
+	var tail struct {
+		LastSuccess int64
+		Attempts    int32
+	}
+	if err = binary.Read(r, binary.LittleEndian, &tail); err != nil {
+		return a, err
+	}
+	return a, nil
+}
+
+// CAddress in the disk format: version, time, services, address, port
+func readAddress(r io.Reader) (Addr, error) {
+	var a Addr
+	var hdr struct {
+		Version uint32
+		Time    uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return a, err
+	}
+	v2 := hdr.Version&addrV2Format != 0
+	if v2 {
+		services, err := wire.ReadVarInt(r, 0)
+		if err != nil {
+			return a, err
+		}
+		a.Services = wire.ServiceFlag(services)
+	} else {
+		var services uint64
+		if err := binary.Read(r, binary.LittleEndian, &services); err != nil {
+			return a, err
+		}
+		a.Services = wire.ServiceFlag(services)
+	}
+	ip, err := readNetAddr(r, v2)
+	if err != nil {
+		return a, err
+	}
+	var port uint16
+	if err = binary.Read(r, binary.BigEndian, &port); err != nil {
+		return a, err
+	}
+	if ip = routable(ip); ip != nil {
+		a.IP = ip
+		a.Port = port
+		a.LastSeen = time.Unix(int64(hdr.Time), 0)
+	}
+	return a, nil
+}
+
+// CNetAddr, legacy 16 bytes ipv6 (ipv4 mapped) or BIP155 encoded.
+// Returns nil ip for the networks we can not dial.
+func readNetAddr(r io.Reader, v2 bool) (net.IP, error) {
+	if !v2 {
+		b := make([]byte, net.IPv6len)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return net.IP(b), nil
+	}
+	var id [1]byte
+	if _, err := io.ReadFull(r, id[:]); err != nil {
+		return nil, err
+	}
+	size, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxAddrSize {
+		return nil, fmt.Errorf("address is too long: %d bytes", size)
+	}
+	b := make([]byte, size)
+	if _, err = io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	switch {
+	case id[0] == netIPv4 && size == net.IPv4len:
+		return net.IP(b), nil
+	case id[0] == netIPv6 && size == net.IPv6len:
+		return net.IP(b), nil
+	}
+	// tor, i2p, cjdns
+	return nil, nil
+}
@@ -0,0 +1,148 @@
+package seeds
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/peers.dat")
+
+// NODE_NETWORK_LIMITED, btcd wire does not have it
+const nodeNetworkLimited wire.ServiceFlag = 1 << 10
+
+// BIP155 network id of tor v3, skipped by the parser
+const netTorV3 = 4
+
+// peersDatEntry is one addrman entry of the fixture
+type peersDatEntry struct {
+	net      byte
+	addr     []byte
+	port     uint16
+	services wire.ServiceFlag
+	time     uint32
+}
+
+var fixtureEntries = []peersDatEntry{
+	{netIPv4, net.ParseIP("203.0.113.7").To4(), 8333, wire.SFNodeNetwork | wire.SFNodeWitness, 1690000000},
+	{netIPv6, net.ParseIP("2001:db8::1"), 8333, wire.SFNodeNetwork, 1690000100},
+	{netTorV3, bytes.Repeat([]byte{0xab}, 32), 8333, wire.SFNodeNetwork, 1690000200},
+	// internal addresses of the dns seeds
+	{netIPv6, net.ParseIP("fd6b:88c0:8724::1"), 8333, 0, 1690000300},
+	{netIPv4, net.ParseIP("198.51.100.20").To4(), 18444, nodeNetworkLimited, 1690000400},
+}
+
+// fixture entries the parser returns, tried ones go after the new ones
+var fixtureAddrs = []Addr{
+	{IP: net.ParseIP("203.0.113.7").To4(), Port: 8333, Services: wire.SFNodeNetwork | wire.SFNodeWitness, LastSeen: time.Unix(1690000000, 0)},
+	{IP: net.ParseIP("2001:db8::1"), Port: 8333, Services: wire.SFNodeNetwork, LastSeen: time.Unix(1690000100, 0)},
+	{IP: net.ParseIP("198.51.100.20").To4(), Port: 18444, Services: nodeNetworkLimited, LastSeen: time.Unix(1690000400, 0)},
+}
+
+// writePeersDat serializes entries like Bitcoin Core addrman,
+// the last tried entries are in the tried table
+func writePeersDat(magic wire.BitcoinNet, entries []peersDatEntry, tried int) []byte {
+	var b bytes.Buffer
+	le := func(v interface{}) { _ = binary.Write(&b, binary.LittleEndian, v) }
+	netAddr := func(e peersDatEntry) {
+		b.WriteByte(e.net)
+		_ = wire.WriteVarInt(&b, 0, uint64(len(e.addr)))
+		b.Write(e.addr)
+	}
+	le(uint32(magic))
+	b.WriteByte(4)
+	b.WriteByte(addrmanCompatBase + addrmanFormatBIP155)
+	b.Write(bytes.Repeat([]byte{0x42}, 32))
+	newCount := len(entries) - tried
+	le(int32(newCount))
+	le(int32(tried))
+	le(int32(1024 ^ (1 << 30)))
+	for _, e := range entries {
+		le(uint32(addrV2Format | 250000))
+		le(e.time)
+		_ = wire.WriteVarInt(&b, 0, uint64(e.services))
+		netAddr(e)
+		_ = binary.Write(&b, binary.BigEndian, e.port)
+		// source
+		netAddr(peersDatEntry{net: netIPv4, addr: []byte{192, 0, 2, 1}})
+		le(int64(e.time))
+		le(int32(1))
+	}
+	// new buckets, every new entry in the first one
+	for i := 0; i < 1024; i++ {
+		if i > 0 {
+			le(int32(0))
+			continue
+		}
+		le(int32(newCount))
+		for j := 0; j < newCount; j++ {
+			le(int32(j))
+		}
+	}
+	b.Write(chainhash.DoubleHashB(b.Bytes()))
+	return b.Bytes()
+}
+
+func TestPeersDatFixture(t *testing.T) {
+	path := filepath.Join("testdata", "peers.dat")
+	data := writePeersDat(wire.MainNet, fixtureEntries, 1)
+	if *update {
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf("failed to write the fixture: %v", err)
+		}
+	}
+	fixture, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read the fixture: %v", err)
+	}
+	if !bytes.Equal(fixture, data) {
+		t.Fatalf("fixture differs from the serialized entries, run with -update")
+	}
+
+	addrs, err := Load(path, wire.MainNet, 8333)
+	if err != nil {
+		t.Fatalf("failed to load the fixture: %v", err)
+	}
+	if len(addrs) != len(fixtureAddrs) {
+		t.Fatalf("got %d addresses, want %d: %v", len(addrs), len(fixtureAddrs), Endpoints(addrs))
+	}
+	for i, a := range addrs {
+		want := fixtureAddrs[i]
+		if !a.IP.Equal(want.IP) || a.Port != want.Port || a.Services != want.Services || !a.LastSeen.Equal(want.LastSeen) {
+			t.Errorf("address %d = %+v, want %+v", i, a, want)
+		}
+	}
+}
+
+func TestPeersDatErrors(t *testing.T) {
+	data := writePeersDat(wire.MainNet, fixtureEntries, 0)
+
+	if _, err := ParsePeersDat(data, wire.TestNet3); err == nil {
+		t.Errorf("peers.dat of another network is accepted")
+	}
+
+	corrupted := append([]byte(nil), data...)
+	corrupted[60] ^= 1
+	if _, err := ParsePeersDat(corrupted, wire.MainNet); err == nil {
+		t.Errorf("peers.dat with a bad checksum is accepted")
+	}
+
+	if _, err := ParsePeersDat(data[:40], wire.MainNet); err == nil {
+		t.Errorf("short peers.dat is accepted")
+	}
+
+	// entries cut off, checksum is valid
+	body := data[:len(data)-chainhash.HashSize-4096-40]
+	truncated := append(append([]byte(nil), body...), chainhash.DoubleHashB(body)...)
+	if _, err := ParsePeersDat(truncated, wire.MainNet); err == nil {
+		t.Errorf("truncated peers.dat is accepted")
+	}
+}
@@ -0,0 +1,42 @@
+package seeds
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// entry of `bitcoin-cli getnodeaddresses 0` output
+type nodeAddress struct {
+	Time     int64  `json:"time"`
+	Services uint64 `json:"services"`
+	Address  string `json:"address"`
+	Port     uint16 `json:"port"`
+	Network  string `json:"network"`
+}
+
+// ParseNodeAddresses parses json output of the getnodeaddresses rpc call.
+// Only ipv4 and ipv6 addresses are returned, other networks are skipped.
+func ParseNodeAddresses(data []byte) ([]Addr, error) {
+	var list []nodeAddress
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse getnodeaddresses json: %v", err)
+	}
+	ret := make([]Addr, 0, len(list))
+	for _, na := range list {
+		ip := routable(net.ParseIP(na.Address))
+		if ip == nil || na.Port == 0 {
+			continue
+		}
+		ret = append(ret, Addr{
+			IP:       ip,
+			Port:     na.Port,
+			Services: wire.ServiceFlag(na.Services),
+			LastSeen: time.Unix(na.Time, 0),
+		})
+	}
+	return ret, nil
+}
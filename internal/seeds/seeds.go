@@ -0,0 +1,88 @@
+// load bootstrap nodes from local sources:
+// Bitcoin Core peers.dat, `bitcoin-cli getnodeaddresses 0` json dumps
+// and plain host:port lists
+package seeds
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Addr is a typed node address parsed from any of the seed sources
+type Addr struct {
+	IP       net.IP
+	Port     uint16
+	Services wire.ServiceFlag
+	LastSeen time.Time
+}
+
+// wrapper with brackets for ipv6, same format the client uses for the nodes
+func (a Addr) Endpoint() string {
+	return fmt.Sprintf("[%s]:%d", a.IP.String(), a.Port)
+}
+
+// Endpoints converts addresses to the endpoints accepted by client.AddNodes
+func Endpoints(addrs []Addr) []string {
+	ret := make([]string, len(addrs))
+	for i, a := range addrs {
+		ret[i] = a.Endpoint()
+	}
+	return ret
+}
+
+// Load detects the format of the file and parses it.
+// magic is used to validate peers.dat, port is used for the entries without one.
+func Load(path string, magic wire.BitcoinNet, port uint16) ([]Addr, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case filepath.Ext(path) == ".dat" || isPeersDat(data, magic):
+		return ParsePeersDat(data, magic)
+	case len(trimmed) > 0 && trimmed[0] == '[':
+		return ParseNodeAddresses(data)
+	default:
+		return ParseList(data, port)
+	}
+}
+
+func isPeersDat(data []byte, magic wire.BitcoinNet) bool {
+	return len(data) >= 4 && binary.LittleEndian.Uint32(data[:4]) == uint32(magic)
+}
+
+// routable returns a usable ip or nil for the addresses we can not dial
+// (tor v2 onioncat, internal addresses, unspecified)
+func routable(ip net.IP) net.IP {
+	if ip == nil || ip.IsUnspecified() {
+		return nil
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	if onionCat.Contains(ip) || internal.Contains(ip) {
+		return nil
+	}
+	return ip
+}
+
+var (
+	onionCat = &net.IPNet{IP: net.ParseIP("fd87:d87e:eb43::"), Mask: net.CIDRMask(48, 128)}
+	internal = &net.IPNet{IP: net.ParseIP("fd6b:88c0:8724::"), Mask: net.CIDRMask(48, 128)}
+)
+
+func trimComment(line string) string {
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		line = line[:i]
+	}
+	return strings.TrimSpace(line)
+}
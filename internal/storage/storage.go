@@ -5,19 +5,27 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/1F47E/go-btc-xray/internal/client/node"
 	"github.com/1F47E/go-btc-xray/internal/config"
 )
 
-var cfg = config.New()
+// Storage writes the nodes file and the reports of one network
+type Storage struct {
+	cfg *config.Config
+}
+
+func New(cfg *config.Config) *Storage {
+	return &Storage{cfg: cfg}
+}
 
-func Bootstrap() error {
-	err := createDir(cfg.LogsDir)
+func (s *Storage) Bootstrap() error {
+	err := createDir(s.cfg.LogsDir)
 	if err != nil {
 		return fmt.Errorf("failed to create logs dir: %v", err)
 	}
-	err = createDir(cfg.DataDir)
+	err = createDir(s.cfg.DataDir)
 	if err != nil {
 		return fmt.Errorf("failed to create data dir: %v", err)
 	}
@@ -28,34 +36,80 @@ func createDir(dir string) error {
 	return os.MkdirAll(dir, 0755)
 }
 
-func Load(filename string) ([]string, error) {
-	var ret []string
+// Load reads saved node records.
+// Older files with a plain list of endpoints are supported as well.
+func Load(filename string) ([]node.Record, error) {
+	var ret []node.Record
 	// read from json
 	fData, err := os.ReadFile(filename)
 	if err != nil {
 		return ret, err
 	}
 	err = json.Unmarshal(fData, &ret)
-	if err != nil {
+	if err == nil {
+		return ret, nil
+	}
+	var endpoints []string
+	if json.Unmarshal(fData, &endpoints) != nil {
 		return ret, err
 	}
+	ret = make([]node.Record, len(endpoints))
+	for i, e := range endpoints {
+		ret[i] = node.Record{Endpoint: e}
+	}
 	return ret, nil
 }
 
-func Save(nodes []*node.Node) error {
-	path := filepath.Join(cfg.DataDir, cfg.NodesFilename)
+func (s *Storage) Save(nodes []*node.Node) error {
+	path := filepath.Join(s.cfg.DataDir, s.cfg.NodesFilename)
 	// save nodes as json
-	fData := make([]string, len(nodes))
+	fData := make([]node.Record, len(nodes))
 	for i, n := range nodes {
-		fData[i] = n.EndpointSafe() // [addr]:port for ipv6
+		fData[i] = n.Record()
 	}
-	fDataJson, err := json.MarshalIndent(fData, "", "  ")
+	return writeJson(path, fData)
+}
+
+// SaveReport saves aggregated data next to the nodes file,
+// data/mainnet.json -> data/mainnet_<name>.json
+func (s *Storage) SaveReport(name string, v interface{}) error {
+	return writeJson(s.Path(name+".json"), v)
+}
+
+// Path of a file next to the nodes file, data/mainnet_<name>
+func (s *Storage) Path(name string) string {
+	base := strings.TrimSuffix(s.cfg.NodesFilename, filepath.Ext(s.cfg.NodesFilename))
+	return filepath.Join(s.cfg.DataDir, fmt.Sprintf("%s_%s", base, name))
+}
+
+func writeJson(path string, v interface{}) error {
+	fDataJson, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to marshal nodes: %v", err)
+		return fmt.Errorf("failed to marshal %s: %v", filepath.Base(path), err)
 	}
 	err = os.WriteFile(path, fDataJson, 0644)
 	if err != nil {
-		return fmt.Errorf("failed to write nodes: %v", err)
+		return fmt.Errorf("failed to write %s: %v", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// AppendReport adds the report as a json line to data/mainnet_<name>.jsonl,
+// for the values tracked over time
+func (s *Storage) AppendReport(name string, v interface{}) error {
+	path := s.Path(name + ".jsonl")
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %v", filepath.Base(path), err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", filepath.Base(path), err)
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %v", filepath.Base(path), err)
 	}
 	return nil
 }
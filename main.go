@@ -10,89 +10,185 @@
 package main
 
 import (
-	"context"
-	"net/http"
-	_ "net/http/pprof"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
+	"strings"
 
-	"github.com/1F47E/go-btc-xray/internal/client"
 	"github.com/1F47E/go-btc-xray/internal/config"
-	"github.com/1F47E/go-btc-xray/internal/dns"
-	"github.com/1F47E/go-btc-xray/internal/gui"
-	"github.com/1F47E/go-btc-xray/internal/logger"
-	"github.com/1F47E/go-btc-xray/internal/printer"
-	"github.com/1F47E/go-btc-xray/internal/storage"
 )
 
-func main() {
-	printer.Banner()
+// command is one xray subcommand with its own flags,
+// the config flags are added to every command
+type command struct {
+	name string
+	// positional arguments in the usage line
+	usage string
+	short string
+	help  string
+	// number of positional arguments, -1 for any
+	nargs int
+	fs    *flag.FlagSet
+	run   func(cfg *config.Config, args []string) error
+}
 
-	var err error
-	cfg := config.New()
+func newCommand(name, usage, short, help string, nargs int) *command {
+	return &command{
+		name:  name,
+		usage: usage,
+		short: short,
+		help:  help,
+		nargs: nargs,
+		fs:    flag.NewFlagSet(name, flag.ContinueOnError),
+	}
+}
 
-	guiCh := make(chan gui.IncomingData, 42)
-	log := logger.New(guiCh)
+func commands() []*command {
+	return []*command{
+		crawlCommand(),
+		monitorCommand(),
+		seedCommand(),
+		probeCommand(),
+		exportCommand(),
+		diffCommand(),
+		statsCommand(),
+		serveCommand(),
+		configCommand(),
+	}
+}
 
-	// create temp folders
-	err = storage.Bootstrap()
-	if err != nil {
-		log.Fatalf("failed to bootstrap the storage: %v", err)
+func configCommand() *command {
+	c := newCommand("config", "print", "print the effective config",
+		"Prints the config from the file, env and flags in the config file format.", 1)
+	c.run = func(cfg *config.Config, args []string) error {
+		if args[0] != "print" {
+			return fmt.Errorf("unknown config command %q, expected print", args[0])
+		}
+		data, err := cfg.YAML()
+		if err != nil {
+			return fmt.Errorf("failed to print the config: %v", err)
+		}
+		fmt.Print(string(data))
+		return nil
 	}
+	return c
+}
 
-	ctx, cancel := context.WithCancel(context.Background())
+// xray [command] [flags] [args], crawl by default
+func main() {
+	cmds := commands()
 
-	// TUI
-	var ui *gui.GUI
-	if cfg.Gui {
-		ui = gui.New(ctx, guiCh)
-		go ui.Start()
+	args := os.Args[1:]
+	name := "crawl"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		help(cmds, args)
+		return
+	}
+	var c *command
+	for _, cmd := range cmds {
+		if cmd.name == name {
+			c = cmd
+		}
+	}
+	if c == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage(cmds)
+		os.Exit(2)
 	}
 
-	// RPC CLIENT
-	c := client.NewClient(ctx, log, guiCh)
+	// flags of the command are listed without the config ones
+	own := make(map[string]bool)
+	c.fs.VisitAll(func(f *flag.Flag) { own[f.Name] = true })
+	c.fs.Usage = func() { c.printUsage(own) }
+	// loaded once and passed down, packages keep no config of their own
+	cfg, rest, err := config.Load(c.fs, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		// flag errors are printed by the flag set
+		if !strings.HasPrefix(err.Error(), "flag ") {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(2)
+	}
+	if c.nargs >= 0 && len(rest) != c.nargs {
+		c.printUsage(own)
+		os.Exit(2)
+	}
+	err = c.run(cfg, rest)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "xray %s: %v\n", c.name, err)
+		os.Exit(1)
+	}
+}
 
-	if os.Getenv("DRY_RUN") != "1" {
-		// DNS SCAN
-		// scan seed nodes, add them to the client
-		go func() {
-			d := dns.New(log)
-			addrs := d.Scan()
-			if len(addrs) == 0 {
-				log.Fatalf("no seed nodes found")
+func (c *command) printUsage(own map[string]bool) {
+	out := c.fs.Output()
+	fmt.Fprintf(out, "usage: xray %s [flags]", c.name)
+	if c.usage != "" {
+		fmt.Fprintf(out, " %s", c.usage)
+	}
+	fmt.Fprintf(out, "\n\n%s\n", c.help)
+	if len(own) > 0 {
+		fmt.Fprintf(out, "\nflags:\n")
+		// a flag set with only the own flags for PrintDefaults
+		fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+		fs.SetOutput(out)
+		c.fs.VisitAll(func(f *flag.Flag) {
+			if own[f.Name] {
+				fs.Var(f.Value, f.Name, f.Usage)
 			}
-			c.AddNodes(addrs)
-			// start the client after seed nodes are added
-			go c.Start()
-		}()
+		})
+		fs.PrintDefaults()
 	}
+	fmt.Fprintf(out, "\nconfig flags are accepted as well, see xray help config\n")
+}
 
-	// PROFILING
-	if os.Getenv("PPROF") == "1" {
-		go func() {
-			_ = http.ListenAndServe("localhost:6060", nil)
-		}()
+func usage(cmds []*command) {
+	fmt.Fprintf(os.Stderr, "usage: xray <command> [flags] [args]\n\ncommands:\n")
+	for _, c := range cmds {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.short)
 	}
+	fmt.Fprintf(os.Stderr, "\nxray help <command> for the command help, xray help config for the config flags\n")
+}
 
-	// GRACEFUL SHUTDOWN
-	go func() {
-		stop := make(chan os.Signal, 1)
-		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
-		<-stop
-		log.Debug("received exit signal, canceling ctx")
-		cancel()
-	}()
-
-	log.Debug("waiting for the context to be canceled")
-	// blocking, waiting for all the goroutines to exit
-	<-ctx.Done()
-	log.Debug("context canceled, exiting")
-	log.ResetToStdout()
-	// exit from GUI
-	if ui != nil {
-		go ui.Stop()
-	}
-	// RPC disconnect from all the nodes
-	c.Disconnect()
+// help of a command, the config flags or the list of commands
+func help(cmds []*command, args []string) {
+	if len(args) == 0 {
+		usage(cmds)
+		return
+	}
+	// config flags for every command, from the file, env and command line
+	if args[0] == "config" {
+		fs := flag.NewFlagSet("config", flag.ContinueOnError)
+		fs.SetOutput(os.Stdout)
+		fs.Usage = func() {
+			fmt.Fprintf(os.Stdout, "usage: xray config print [flags]\n\n")
+			fmt.Fprintf(os.Stdout, "config flags of every command, each has a key in the config file and an env variable:\n\n")
+			fs.PrintDefaults()
+		}
+		_, _, err := config.Load(fs, []string{"-h"})
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		return
+	}
+	for _, c := range cmds {
+		if c.name == args[0] {
+			own := make(map[string]bool)
+			c.fs.VisitAll(func(f *flag.Flag) { own[f.Name] = true })
+			c.fs.SetOutput(os.Stdout)
+			c.printUsage(own)
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+	usage(cmds)
+	os.Exit(2)
 }
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/1F47E/go-btc-xray/internal/client/node"
+	"github.com/1F47E/go-btc-xray/internal/cmd"
+	"github.com/1F47E/go-btc-xray/internal/config"
+	"github.com/1F47E/go-btc-xray/internal/logger"
+	"github.com/1F47E/go-btc-xray/internal/seeds"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/sirupsen/logrus"
+)
+
+// feature messages, negotiated if both sides sent them
+var featureCommands = []string{
+	wire.CmdSendHeaders,
+	wire.CmdSendAddrV2,
+	wire.CmdFeeFilter,
+	"wtxidrelay",
+	"sendcmpct",
+}
+
+// probeMessage is one message sent or received, at is since the dial
+type probeMessage struct {
+	At      float64 `json:"at_ms"`
+	Sent    bool    `json:"sent"`
+	Command string  `json:"command"`
+	Size    int     `json:"size"`
+	Detail  string  `json:"detail,omitempty"`
+	// decode error of a received message
+	Error string `json:"error,omitempty"`
+}
+
+// probeVersion is the version message of the peer
+type probeVersion struct {
+	Protocol    int32            `json:"protocol"`
+	Services    wire.ServiceFlag `json:"services"`
+	Timestamp   time.Time        `json:"timestamp"`
+	AddrYou     string           `json:"addr_you"`
+	AddrMe      string           `json:"addr_me"`
+	Nonce       uint64           `json:"nonce"`
+	UserAgent   string           `json:"user_agent"`
+	StartHeight int32            `json:"start_height"`
+	Relay       bool             `json:"relay"`
+}
+
+type probeResult struct {
+	Endpoint  string `json:"endpoint"`
+	Transport string `json:"transport"`
+	// min of ours and theirs
+	Pver       uint32        `json:"pver"`
+	Version    *probeVersion `json:"version"`
+	Negotiated []string      `json:"negotiated"`
+	// features signaled by the peer
+	Features  node.Features   `json:"features"`
+	PingRTT   float64         `json:"ping_ms,omitempty"`
+	Addr      *node.AddrStats `json:"addr,omitempty"`
+	Addresses []string        `json:"addresses"`
+	Messages  []probeMessage  `json:"messages"`
+}
+
+// probeTrace records the messages of the connection,
+// called from the listener and the writing goroutines
+type probeTrace struct {
+	mu        sync.Mutex
+	start     time.Time
+	messages  []probeMessage
+	version   *wire.MsgVersion
+	addresses []string
+	sent      map[string]bool
+	received  map[string]bool
+}
+
+func probeCommand() *command {
+	c := newCommand("probe", "<host:port>", "connect to one node and print the conversation",
+		"Connects to the node, does the handshake, pings and asks for addresses, then prints\n"+
+			"every message exchanged with timings, the version of the node, negotiated features,\n"+
+			"ping round trip and the getaddr answer. The port of the network is used if it is missing.", 1)
+	asJSON := c.fs.Bool("json", false, "print json")
+	c.run = func(cfg *config.Config, args []string) error {
+		a, err := seeds.ParseEndpoint(args[0], cfg.NodesPort)
+		if err != nil {
+			return err
+		}
+		if a.IP == nil {
+			return fmt.Errorf("%s is not a routable address", args[0])
+		}
+		// logs go to stderr, only warnings unless debug
+		cfg.Gui = false
+		log := logger.New(cfg, nil)
+		log.SetOutput(os.Stderr)
+		if !cfg.Debug {
+			log.SetLevel(logrus.WarnLevel)
+		}
+
+		// the listener may send after Connect returns, closed after it exits
+		newAddrCh := make(chan []string, 1)
+		go func() {
+			for range newAddrCh {
+			}
+		}()
+		t := &probeTrace{
+			start:    time.Now(),
+			sent:     make(map[string]bool),
+			received: make(map[string]bool),
+		}
+		n := node.NewNode(cfg, log, a.IP.String(), a.Port, newAddrCh, nil, nil, nil)
+		n.SetTracer(t.add)
+		resCh := make(chan *node.Node, 1)
+		err = n.Connect(context.Background(), resCh)
+		// the connection is closed, wait for the listener before printing
+		n.Wait()
+		close(newAddrCh)
+		if err != nil {
+			return err
+		}
+		if !n.HasVersion() {
+			return fmt.Errorf("%s did not finish the handshake", n.Endpoint())
+		}
+		r := t.result(n)
+		if *asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(r)
+		}
+		r.print(os.Stdout)
+		return nil
+	}
+	return c
+}
+
+func (t *probeTrace) add(sent bool, msg wire.Message, size int, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	command := msg.Command()
+	m := probeMessage{
+		At:      float64(time.Since(t.start).Microseconds()) / 1000,
+		Sent:    sent,
+		Command: command,
+		Size:    size,
+	}
+	if err != nil {
+		m.Error = err.Error()
+		t.messages = append(t.messages, m)
+		return
+	}
+	m.Detail = messageDetail(msg)
+	t.messages = append(t.messages, m)
+	if sent {
+		t.sent[command] = true
+		return
+	}
+	t.received[command] = true
+	switch m := msg.(type) {
+	case *wire.MsgVersion:
+		t.version = m
+	case *wire.MsgAddr:
+		for _, na := range m.AddrList {
+			t.addresses = append(t.addresses, net.JoinHostPort(na.IP.String(), strconv.Itoa(int(na.Port))))
+		}
+	case *wire.MsgAddrV2:
+		for _, na := range m.AddrList {
+			t.addresses = append(t.addresses, net.JoinHostPort(na.Addr.String(), strconv.Itoa(int(na.Port))))
+		}
+	}
+}
+
+func (t *probeTrace) result(n *node.Node) *probeResult {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r := &probeResult{
+		Endpoint:   hostPort(n.EndpointSafe()),
+		Transport:  n.Transport(),
+		Pver:       n.Pver(),
+		Negotiated: make([]string, 0),
+		Features:   n.Features(),
+		Addresses:  append(make([]string, 0, len(t.addresses)), t.addresses...),
+		Messages:   append([]probeMessage(nil), t.messages...),
+	}
+	if m := t.version; m != nil {
+		r.Version = &probeVersion{
+			Protocol:    m.ProtocolVersion,
+			Services:    m.Services,
+			Timestamp:   m.Timestamp,
+			AddrYou:     net.JoinHostPort(m.AddrYou.IP.String(), strconv.Itoa(int(m.AddrYou.Port))),
+			AddrMe:      net.JoinHostPort(m.AddrMe.IP.String(), strconv.Itoa(int(m.AddrMe.Port))),
+			Nonce:       m.Nonce,
+			UserAgent:   m.UserAgent,
+			StartHeight: m.LastBlock,
+			Relay:       !m.DisableRelayTx,
+		}
+	}
+	for _, c := range featureCommands {
+		if t.sent[c] && t.received[c] {
+			r.Negotiated = append(r.Negotiated, c)
+		}
+	}
+	if rtt := n.PingRTT(); rtt > 0 {
+		r.PingRTT = float64(rtt.Microseconds()) / 1000
+	}
+	if a := n.AddrStats(); a.Messages > 0 {
+		r.Addr = &a
+	}
+	return r
+}
+
+// messageDetail is a short summary of the message fields
+func messageDetail(msg wire.Message) string {
+	switch m := msg.(type) {
+	case *wire.MsgVersion:
+		return fmt.Sprintf("pver %d, %s, height %d", m.ProtocolVersion, m.UserAgent, m.LastBlock)
+	case *wire.MsgPing:
+		return fmt.Sprintf("nonce %d", m.Nonce)
+	case *wire.MsgPong:
+		return fmt.Sprintf("nonce %d", m.Nonce)
+	case *wire.MsgAddr:
+		return fmt.Sprintf("%d addresses", len(m.AddrList))
+	case *wire.MsgAddrV2:
+		return fmt.Sprintf("%d addresses", len(m.AddrList))
+	case *wire.MsgInv:
+		return fmt.Sprintf("%d items", len(m.InvList))
+	case *wire.MsgGetData:
+		return fmt.Sprintf("%d items", len(m.InvList))
+	case *wire.MsgNotFound:
+		return fmt.Sprintf("%d items", len(m.InvList))
+	case *wire.MsgFeeFilter:
+		return fmt.Sprintf("%d sat/kvB", m.MinFee)
+	case *wire.MsgGetHeaders:
+		return fmt.Sprintf("%d locator hashes", len(m.BlockLocatorHashes))
+	case *wire.MsgHeaders:
+		return fmt.Sprintf("%d headers", len(m.Headers))
+	case *wire.MsgBlock:
+		return m.BlockHash().String()
+	case *cmd.MsgSendCmpct:
+		return fmt.Sprintf("version %d, announce %v", m.Version, m.Announce)
+	case *cmd.MsgCmpctBlock:
+		return m.Header.BlockHash().String()
+	case *cmd.MsgUnknown:
+		return "unknown command"
+	}
+	return ""
+}
+
+// addresses printed in the text output
+const probeAddrs = 10
+
+func (r *probeResult) print(w io.Writer) {
+	fmt.Fprintf(w, "endpoint:   %s\n", r.Endpoint)
+	fmt.Fprintf(w, "transport:  %s\n", r.Transport)
+
+	fmt.Fprintf(w, "\nmessages:\n")
+	for _, m := range r.Messages {
+		dir := "recv"
+		if m.Sent {
+			dir = "send"
+		}
+		detail := m.Detail
+		if m.Error != "" {
+			detail = "ERR: " + m.Error
+		}
+		fmt.Fprintf(w, "  %9.1fms  %s  %-12s %7d B  %s\n", m.At, dir, m.Command, m.Size, detail)
+	}
+
+	if v := r.Version; v != nil {
+		fmt.Fprintf(w, "\nversion:\n")
+		fmt.Fprintf(w, "  protocol:   %d\n", v.Protocol)
+		fmt.Fprintf(w, "  services:   %s\n", v.Services)
+		fmt.Fprintf(w, "  user agent: %s\n", v.UserAgent)
+		fmt.Fprintf(w, "  height:     %d\n", v.StartHeight)
+		fmt.Fprintf(w, "  timestamp:  %s\n", v.Timestamp.UTC().Format(time.RFC3339))
+		fmt.Fprintf(w, "  addr you:   %s\n", v.AddrYou)
+		fmt.Fprintf(w, "  addr me:    %s\n", v.AddrMe)
+		fmt.Fprintf(w, "  nonce:      %d\n", v.Nonce)
+		fmt.Fprintf(w, "  relay:      %v\n", v.Relay)
+	}
+
+	fmt.Fprintf(w, "\nnegotiated:\n")
+	fmt.Fprintf(w, "  pver:       %d\n", r.Pver)
+	fmt.Fprintf(w, "  features:   %v\n", r.Negotiated)
+	if f := r.Features; f.FeeFilter != nil {
+		fmt.Fprintf(w, "  feefilter:  %d sat/kvB\n", *f.FeeFilter)
+	}
+	for _, c := range r.Features.SendCmpct {
+		fmt.Fprintf(w, "  sendcmpct:  version %d, announce %v\n", c.Version, c.Announce)
+	}
+	if len(r.Features.Unknown) > 0 {
+		fmt.Fprintf(w, "  unknown:    %v\n", r.Features.Unknown)
+	}
+
+	fmt.Fprintln(w)
+	if r.PingRTT > 0 {
+		fmt.Fprintf(w, "ping:       %.1fms\n", r.PingRTT)
+	} else {
+		fmt.Fprintf(w, "ping:       no pong\n")
+	}
+	if r.Addr == nil {
+		fmt.Fprintf(w, "addresses:  none\n")
+		return
+	}
+	fmt.Fprintf(w, "addresses:  %d in the getaddr answer, %d relayed\n", r.Addr.Response, r.Addr.Relayed)
+	for i, a := range r.Addresses {
+		if i == probeAddrs {
+			fmt.Fprintf(w, "  ... %d more, --json for all\n", len(r.Addresses)-probeAddrs)
+			break
+		}
+		fmt.Fprintf(w, "  %s\n", a)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/1F47E/go-btc-xray/internal/config"
+	"github.com/1F47E/go-btc-xray/internal/storage"
+)
+
+// report names, data/mainnet_<name>.json
+var reportName = regexp.MustCompile(`^[a-z_]+$`)
+
+func serveCommand() *command {
+	c := newCommand("serve", "", "serve saved nodes and reports over http",
+		"Read only json api over the data dir, files are read on every request\n"+
+			"so a crawl running next to it is picked up:\n"+
+			"  /              index\n"+
+			"  /nodes         good nodes\n"+
+			"  /stats         nodes summary, as xray stats\n"+
+			"  /reports/<name> report, seeds, features, fees, addr, chain...", 0)
+	listen := c.fs.String("listen", "localhost:8080", "http address")
+	c.run = func(cfg *config.Config, args []string) error {
+		nodesPath := filepath.Join(cfg.DataDir, cfg.NodesFilename)
+		store := storage.New(cfg)
+		mux := http.NewServeMux()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/" {
+				http.NotFound(w, r)
+				return
+			}
+			reports, _ := filepath.Glob(store.Path("*.json"))
+			prefix := store.Path("")
+			names := make([]string, 0, len(reports))
+			for _, p := range reports {
+				names = append(names, "/reports/"+strings.TrimSuffix(strings.TrimPrefix(p, prefix), ".json"))
+			}
+			writeJSON(w, map[string]interface{}{
+				"network": cfg.Name,
+				"nodes":   "/nodes",
+				"stats":   "/stats",
+				"reports": names,
+			})
+		})
+		mux.HandleFunc("/nodes", func(w http.ResponseWriter, r *http.Request) {
+			serveFile(w, r, nodesPath)
+		})
+		mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+			records, err := storage.Load(nodesPath)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("failed to load nodes: %v", err), http.StatusNotFound)
+				return
+			}
+			writeJSON(w, summarize(records, 0))
+		})
+		mux.HandleFunc("/reports/", func(w http.ResponseWriter, r *http.Request) {
+			name := strings.TrimPrefix(r.URL.Path, "/reports/")
+			if !reportName.MatchString(name) {
+				http.NotFound(w, r)
+				return
+			}
+			serveFile(w, r, store.Path(name+".json"))
+		})
+
+		srv := &http.Server{Addr: *listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			stop := make(chan os.Signal, 1)
+			signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+			<-stop
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = srv.Shutdown(ctx)
+		}()
+		fmt.Fprintf(os.Stderr, "serving %s on http://%s\n", cfg.DataDir, *listen)
+		err := srv.ListenAndServe()
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	}
+	return c
+}
+
+func serveFile(w http.ResponseWriter, r *http.Request, path string) {
+	if _, err := os.Stat(path); err != nil {
+		http.Error(w, fmt.Sprintf("%s is not saved yet", filepath.Base(path)), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	http.ServeFile(w, r, path)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
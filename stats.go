@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/1F47E/go-btc-xray/internal/client/node"
+	"github.com/1F47E/go-btc-xray/internal/config"
+	"github.com/1F47E/go-btc-xray/internal/storage"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// count of the nodes with a value
+type count struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// nodesStats summarizes a nodes file
+type nodesStats struct {
+	Nodes        int     `json:"nodes"`
+	MaxHeight    int32   `json:"max_height"`
+	MedianHeight int32   `json:"median_height"`
+	UserAgents   []count `json:"user_agents"`
+	Versions     []count `json:"versions"`
+	Services     []count `json:"services"`
+	Transports   []count `json:"transports,omitempty"`
+	ChainStatus  []count `json:"chain_status,omitempty"`
+	Prune        []count `json:"prune,omitempty"`
+	Countries    []count `json:"countries,omitempty"`
+	ASNs         []count `json:"asns,omitempty"`
+}
+
+func statsCommand() *command {
+	c := newCommand("stats", "<file>", "summarize a saved nodes file",
+		"Prints node counts by user agent, protocol version, service bits, transport,\n"+
+			"chain status, pruning, country and ASN of a nodes file saved by a crawl.", 1)
+	asJSON := c.fs.Bool("json", false, "print json")
+	top := c.fs.Int("top", 10, "entries in every list, 0 for all")
+	c.run = func(cfg *config.Config, args []string) error {
+		records, err := storage.Load(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to load nodes: %v", err)
+		}
+		s := summarize(records, *top)
+		if *asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(s)
+		}
+		s.print(os.Stdout)
+		return nil
+	}
+	return c
+}
+
+// summarize the records, lists are cut to top entries if top > 0
+func summarize(records []node.Record, top int) *nodesStats {
+	s := &nodesStats{Nodes: len(records)}
+	agents := make(map[string]int)
+	versions := make(map[string]int)
+	services := make(map[string]int)
+	transports := make(map[string]int)
+	chain := make(map[string]int)
+	prune := make(map[string]int)
+	countries := make(map[string]int)
+	asns := make(map[string]int)
+	heights := make([]int32, 0, len(records))
+	for _, r := range records {
+		if r.Version == 0 {
+			continue
+		}
+		agents[r.UserAgent]++
+		versions[fmt.Sprint(r.Version)]++
+		for bit := 0; bit < 64; bit++ {
+			if sf := wire.ServiceFlag(1) << bit; r.Services&sf != 0 {
+				services[sf.String()]++
+			}
+		}
+		add(transports, r.Transport)
+		add(chain, string(r.ChainStatus))
+		add(prune, string(r.Prune))
+		add(countries, r.Country)
+		if r.ASN != 0 {
+			asns[fmt.Sprintf("AS%d %s", r.ASN, r.Org)]++
+		}
+		heights = append(heights, r.Height)
+	}
+	if len(heights) > 0 {
+		sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+		s.MaxHeight = heights[len(heights)-1]
+		s.MedianHeight = heights[len(heights)/2]
+	}
+	s.UserAgents = counts(agents, top)
+	s.Versions = counts(versions, top)
+	s.Services = counts(services, 0)
+	s.Transports = counts(transports, 0)
+	s.ChainStatus = counts(chain, 0)
+	s.Prune = counts(prune, 0)
+	s.Countries = counts(countries, top)
+	s.ASNs = counts(asns, top)
+	return s
+}
+
+// add skips empty values, not recorded by the crawl
+func add(m map[string]int, v string) {
+	if v != "" {
+		m[v]++
+	}
+}
+
+// counts sorted by count, then by name
+func counts(m map[string]int, top int) []count {
+	ret := make([]count, 0, len(m))
+	for name, n := range m {
+		ret = append(ret, count{Name: name, Count: n})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Count != ret[j].Count {
+			return ret[i].Count > ret[j].Count
+		}
+		return ret[i].Name < ret[j].Name
+	})
+	if top > 0 && len(ret) > top {
+		ret = ret[:top]
+	}
+	return ret
+}
+
+func (s *nodesStats) print(w io.Writer) {
+	fmt.Fprintf(w, "nodes: %d\n", s.Nodes)
+	fmt.Fprintf(w, "height: max %d, median %d\n", s.MaxHeight, s.MedianHeight)
+	lists := []struct {
+		title string
+		list  []count
+	}{
+		{"user agents", s.UserAgents},
+		{"versions", s.Versions},
+		{"services", s.Services},
+		{"transports", s.Transports},
+		{"chain status", s.ChainStatus},
+		{"prune", s.Prune},
+		{"countries", s.Countries},
+		{"asns", s.ASNs},
+	}
+	for _, l := range lists {
+		if len(l.list) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s:\n", l.title)
+		for _, c := range l.list {
+			fmt.Fprintf(w, "  %6d  %s\n", c.Count, c.Name)
+		}
+	}
+}